@@ -10,6 +10,8 @@ off_t mem[MEMSIZE];	/* 64k 内存 */
 
 char pgmName[32];	/* 汇编程序 */
 char codName[32];	/* 机器代码 */
+char mapName[32];	/* 源代码行映射 */
+char symName[32];	/* 标号表 */
 
 FILE *source, *code;	/* 文件指针 */
 
@@ -18,8 +20,17 @@ int line = 0;		/* 行计数器 */
 
 int state = 0;		/* 状态标志 */
 int Error = 0;		/* 错误标志 */
+int noWarn = 0;		/* 关闭警告 */
+int jsonOut = 0;	/* JSON格式输出 */
+int mapOut = 0;		/* 输出源代码行映射 */
+int symOut = 0;		/* 输出标号表 */
+int tokPos = 0;		/* 记号开始的列 */
+int startLine = 0;	/* START所在的行 */
+
+char isData[MEMSIZE];	/* DC/DS定义的数据区 */
 
 char buf[LINESIZE+2];	/* 行缓冲区	*/
+char src[LINESIZE+2];	/* 源代码行(getToken会修改buf) */
 int  len;		/* 字符串长度	*/
 int  pos;		/* 行下标	*/
 
@@ -39,6 +50,7 @@ getLine(void)
 	len = strlen(buf);
 	if(buf[len-1] == '\n') buf[--len] = '\0';
 	if(len > LINESIZE) QUIT("该行超出72个字符");
+	strcpy(src, buf);
 	pos = 0; getToken();
 }
 
@@ -46,7 +58,7 @@ TokenType
 tok_lookup(char *s)
 {
 	const static char *grs[] = {
-		"GR0", "GR1", "GR2", "GR3", "GR4" };
+		"GR0", "GR1", "GR2", "GR3", "GR4", "GR5", "GR6", "GR7" };
 	const static char *str[] = { 
 		"HALT", "LD", "ST", "LEA",
 		"ADD", "SUB", "MUL", "DIV", "MOD",
@@ -56,7 +68,8 @@ tok_lookup(char *s)
 		"JMP", "JPZ", "JMI", "JNZ", "JZE",
 		"PUSH", "POP", "CALL", "RET",
 		"READ", "WRITE", "IN", "OUT", "EXIT",
-		"START", "END", "DC", "DS" };
+		"START", "END", "DC", "DS",
+		"CLR", "CMOVZ", "TEST", "ADDL", "SUBL" };
 	const static TokenType tok[] = {
 		HALT, LD, ST, LEA,
 		ADD, SUB, MUL, DIV, MOD,
@@ -66,12 +79,13 @@ tok_lookup(char *s)
 		JMP, JPZ, JMI, JNZ, JZE,
 		PUSH, POP, CALL, RET,
 		READ, WRITE, IN, OUT, EXIT,
-		START, END, DC, DS };
+		START, END, DC, DS,
+		CLR, CMOVZ, TEST, ADDL, SUBL };
 	int i;
 	for(i = 0; i < NELEMS(grs); ++i) {
 		if(!strcmp(s, grs[i])) {
 			sprintf(tokStr, "%d", i);
-			return NUM;
+			return REG;
 		}
 	}
 	for(i = 0; i < NELEMS(str); ++i) {
@@ -88,6 +102,7 @@ getToken(void)
 	static int num = 2;
 	static int id = 3;
 	static int done = 4;
+	static int hex = 5;
 	
 	int flag = start;
 	int tokIdx = 0;
@@ -95,6 +110,7 @@ getToken(void)
 	while(flag != done) {
 		int c = buf[pos++];
 		if(flag == start) {
+			if(!isspace(c)) tokPos = pos;
 			if(c == '\0' || c == ';') {
 				buf[--pos] = '\0';
 				tokStr[0] = '\0';
@@ -103,20 +119,26 @@ getToken(void)
 			}else if(c == ',') {
 				token = COMMA;
 				flag = done;
+			}else if(c == '+' || c == '-' || c == '*'
+				|| c == '(' || c == ')') {
+				if(c == '+') token = PLUS;
+				else if(c == '-') token = MINUS;
+				else if(c == '*') token = TIMES;
+				else if(c == '(') token = LPAREN;
+				else token = RPAREN;
+				flag = done;
 			}else if(isupper(c)) {
 				tokStr[tokIdx++] = (char)c;
 				flag = id;
 			}else if(c == '\'') {
 				flag = string;
 				len = 0;
-			}else if(c == '+' || c == '-'
-				|| c == '#' || isdigit(c)) {
-				if(c == '#') {
-					tokStr[tokIdx++] = '0';
-					tokStr[tokIdx++] = 'x';
-				}else {
-					tokStr[tokIdx++] = (char)c;
-				}
+			}else if(c == '#') {
+				tokStr[tokIdx++] = '0';
+				tokStr[tokIdx++] = 'x';
+				flag = hex;
+			}else if(isdigit(c)) {
+				tokStr[tokIdx++] = (char)c;
 				flag = num;
 			}else if(!isspace(c)) QUIT("未知记号");
 		}else if(flag == id) {
@@ -126,8 +148,8 @@ getToken(void)
 				flag = done;
 				pos--;
 			}else tokStr[tokIdx++] = (char)c;
-		}else if(flag == num) {
-			if(!isdigit(c)) {
+		}else if(flag == num || flag == hex) {
+			if(flag == num ? !isdigit(c) : !isxdigit(c)) {
 				tokStr[tokIdx] = '\0';
 				token = NUM;
 				flag = done;
@@ -169,48 +191,177 @@ skipLabel(void)
 	getToken();
 }
 
+/* 记号对应的指令码，新增的指令记号排在伪命令之后，和指令码不同 */
+
+short
+opCode(short op)
+{
+	switch(op) {
+		case CLR: return 0x1E;
+		case CMOVZ: return 0x1F;
+		case TEST: return 0x20;
+		case ADDL: return 0x21;
+		case SUBL: return 0x22;
+		default: return op;
+	}
+}
+
 void
 skipOp(void)
 {
 	short op = token;
-	if(op < HALT || op > DS) QUIT("未知指令");
-	mem[pc] = op << 8;
+	if(op < HALT || op > SUBL) QUIT("未知指令");
+	mem[pc] = opCode(op) << 8;
 	getToken();
 }
 
-void
-skipGR(void)
+/* 寄存器编号，GR和XR统一在这里检查
+   GR0～GR7 是标准的寄存器名，虚拟机目前只实现了 GR0～GR4 */
+
+short
+regNum(const char *what)
 {
-	short gr;
-	if(token != NUM) QUIT("缺少GR");
-	gr = (short)atoi(tokStr);
-	if(gr < 0 || gr > 4) QUIT("GR错误");
-	mem[pc] |= (gr<<4);
+	short r;
+	if(token == ID && !strncmp(tokStr, "GR", 2) && isdigit(tokStr[2]))
+		QUIT("无效的寄存器");
+	if(token != REG) QUIT(what);
+	r = (short)atoi(tokStr);
+	if(r > 4) QUIT("虚拟机没有实现该寄存器（只有GR0～GR4）");
 	getToken();
+	return r;
 }
 
 void
-skipADR()
+skipGR(void)
 {
-	short adr;
+	mem[pc] |= (regNum("缺少GR")<<4);
+}
+
+/* 地址表达式的值
+   val 为常数部分，fwd 为前向引用标号的系数之和，
+   n 为前向引用标号的个数 */
+
+typedef struct {
+	long val;
+	int fwd, n;
+} Value;
+
+Value expr(int off);
+
+/* 数字记号的值：#开头的是十六进制数（记号为0x...），其他是十进制数
+   不能用strtol的自动进制，否则0开头的十进制数会按八进制解析 */
+
+long
+numVal(void)
+{
+	if(!strncmp(tokStr, "0x", 2)) return strtol(tokStr, NULL, 16);
+	return strtol(tokStr, NULL, 10);
+}
+
+/* 因子：数字，标号，或括号中的表达式 */
+
+Value
+primary(int off)
+{
+	Value v = { 0, 0, 0 };
 	if(token == NUM) {
-		adr = (short)atoi(tokStr);
+		v.val = numVal();
+		getToken();
 	}else if(token == ID) {
-		adr = lab_get(tokStr, pc+1);
-	}else QUIT("ADR错误");
-	mem[pc+1] = adr;
-	getToken();
+		if(lab_defined(tokStr)) {
+			v.val = lab_get(tokStr, off);
+		}else {
+			lab_get(tokStr, off);
+			v.fwd = v.n = 1;
+		}
+		getToken();
+	}else if(token == LPAREN) {
+		getToken();
+		v = expr(off);
+		if(token != RPAREN) QUIT("表达式缺少右括号");
+		getToken();
+	}else QUIT("表达式错误");
+	return v;
+}
+
+Value
+unary(int off)
+{
+	Value v;
+	if(token == MINUS) {
+		getToken();
+		v = unary(off);
+		v.val = -v.val;
+		v.fwd = -v.fwd;
+		return v;
+	}
+	if(token == PLUS) getToken();
+	return primary(off);
+}
+
+Value
+term(int off)
+{
+	Value v = unary(off);
+	while(token == TIMES) {
+		Value r;
+		getToken();
+		r = unary(off);
+		if(v.n || r.n) QUIT("前向引用的标号不能参与乘法");
+		v.val *= r.val;
+	}
+	return v;
+}
+
+Value
+expr(int off)
+{
+	Value v = term(off);
+	while(token == PLUS || token == MINUS) {
+		int op = token;
+		Value r;
+		getToken();
+		r = term(off);
+		v.val = (op == PLUS)? v.val + r.val: v.val - r.val;
+		v.fwd = (op == PLUS)? v.fwd + r.fwd: v.fwd - r.fwd;
+		v.n += r.n;
+	}
+	return v;
+}
+
+/* 计算地址表达式，off 为结果存放的位置
+   前向引用的标号最多一个，并且只能加上常数 */
+
+short
+skipExpr(int off)
+{
+	Value v = expr(off);
+	if(v.n > 1 || v.fwd != v.n) QUIT("表达式中前向引用的标号只能有一个并且只能加减常数");
+	if(v.val < -32768 || v.val > 65535) {
+		char msg[LINESIZE+64];
+		Label_T lab = lab_near(pc);
+		if(lab != NULL)
+			sprintf(msg, "表达式溢出: %ld（位于 %s+%d, 第 %d 行定义）",
+				v.val, lab->key, pc - lab->addr, lab->defLine);
+		else
+			sprintf(msg, "表达式溢出: %ld", v.val);
+		QUIT(msg);
+	}
+	return (short)v.val;
+}
+
+void
+skipADR()
+{
+	mem[pc+1] = skipExpr(pc+1);
 }
 
 void
 skipXR()
 {
-	short xr;
-	if(token != NUM) QUIT("XR错误");
-	xr = (short)atoi(tokStr);
-	if(xr < 1 || xr > 4) QUIT("XR错误");
+	short xr = regNum("XR错误");
+	if(xr == 0) QUIT("GR0不能作为XR");
 	mem[pc] |= xr;
-	getToken();
 }
 
 void
@@ -234,15 +385,9 @@ macro_read(void)
 	const short ai = 5;
 	int i;
 
-	if(token == ID)
-		cmd[ai] = lab_get(tokStr, pc+ai);
-	else if(token == NUM)
-		cmd[ai] = (short)atoi(tokStr);
-	else
-		QUIT("READ参数错误");
+	cmd[ai] = skipExpr(pc+ai);
 	for(i = 0; i < NELEMS(cmd); ++i)
 		mem[pc++] = cmd[i];
-	getToken();
 }
 
 void
@@ -258,15 +403,9 @@ macro_write(void)
 		POP  << 8 };
 	const short ai = 5;
 	int i;
-	if(token == ID)
-		cmd[ai] = lab_get(tokStr, pc+ai);
-	else if(token == NUM)
-		cmd[ai] = (short)atoi(tokStr);
-	else
-		QUIT("READ参数错误");
+	cmd[ai] = skipExpr(pc+ai);
 	for(i = 0; i < NELEMS(cmd); ++i)
 		mem[pc++] = cmd[i];
-	getToken();
 }
 
 void
@@ -277,6 +416,7 @@ macro_start(void)
 	if(token != ENDLINE) skipADR();
 	else mem[pc + 1] = pc + 2;
 	state = START;
+	startLine = line;
 	pc += 2;
 }
 
@@ -290,20 +430,18 @@ macro_end(void)
 void
 macro_dc(void)
 {
-	short adr;
-	if(token == NUM) {
-		adr = (short)atoi(tokStr);
-		mem[pc++] = adr;
-	}else if(token == ID) {
-		adr = lab_get(tokStr, pc);
-		mem[pc++] = adr;
-	}else if(token == STRING) {
+	if(token == STRING) {
 		int i = 0;
+		if(pc + len > pc_max) QUIT("数据超出内存范围");
 		while(i < len) {
+			isData[pc] = 1;
 			mem[pc++] = tokStr[i++];
 		}
-	}else QUIT("DC 参数错误");
-	getToken();
+		getToken();
+	}else {
+		mem[pc] = skipExpr(pc);
+		isData[pc++] = 1;
+	}
 }
 
 void
@@ -311,15 +449,60 @@ macro_ds(void)
 {
 	int num;
 	if(token != NUM) QUIT("DS 参数错误");
-	num = atoi(tokStr);
+	num = numVal();
 	if(num < 0 || num > pc_max) QUIT("DS 参数错误");
+	if(pc + num > pc_max) QUIT("数据超出内存范围");
 	getToken();
-	pc += num;
+	while(num-- > 0) isData[pc++] = 1;
+}
+
+/* 源代码行映射：指令地址对应的行号和源代码 */
+
+static struct srcmap {
+	int addr, line;
+	char text[LINESIZE+2];
+} *srcMap = NULL;
+static int nsrcMap = 0, capSrcMap = 0;
+
+void
+mapAdd(int addr, int ln, const char *text)
+{
+	if(!mapOut) return;
+	if(nsrcMap == capSrcMap) {
+		capSrcMap = capSrcMap? capSrcMap*2: 256;
+		srcMap = realloc(srcMap, capSrcMap * sizeof(srcMap[0]));
+		if(srcMap == NULL) QUIT("mapAdd内存分配失败");
+	}
+	while(isspace(*text)) text++;
+	srcMap[nsrcMap].addr = addr;
+	srcMap[nsrcMap].line = ln;
+	strcpy(srcMap[nsrcMap].text, text);
+	nsrcMap++;
+}
+
+/* 映射文件每行为：地址(十六进制) 行号 源代码，用TAB分隔 */
+
+void
+mapWrite(void)
+{
+	int i;
+	FILE *f;
+	if(!mapOut) return;
+	f = fopen(mapName, "w");
+	if(f == NULL) QUIT("映射文件不能打开");
+	for(i = 0; i < nsrcMap; ++i) {
+		fprintf(f, "%04x\t%d\t%s\n", srcMap[i].addr, srcMap[i].line, srcMap[i].text);
+	}
+	fclose(f);
+	free(srcMap);
 }
 
 void
 buildCode(void)
 {
+	int lastOp = -1;	/* 最后一条指令	*/
+	int lastLine = 0;	/* 最后指令的行	*/
+	
 	while(!feof(source)) {
 		int op;
 		getLine();
@@ -327,14 +510,21 @@ buildCode(void)
 		if(pc > pc_max) QUIT("程序太大");
 		skipLabel();
 		op = token;
+		if(state == 0 && op != START) QUIT("缺少START指令（START必须是第一条语句）");
 		skipOp();
+		if(op <= RET || (op >= CLR && op <= SUBL) || op == READ || op == WRITE) {
+			lastOp = op;
+			lastLine = line;
+			mapAdd(pc, line, src);
+		}
 		switch(op) {
 			/* 两个字长的指令 */
 			case LD: case ST: case LEA:
 			case ADD: case SUB: case MUL: case DIV: case MOD:
 			case AND: case OR: case EOR:
 			case SLA: case SRA: case SLL: case SRL:
-			case CPA: case CPL:
+			case CPA: case CPL: case CMOVZ: case TEST:
+			case ADDL: case SUBL:
 				skipGR(); skipCOMMA(); skipADR();
 				if(token != ENDLINE) {
 					skipCOMMA(); skipXR();
@@ -349,8 +539,8 @@ buildCode(void)
 				}
 				pc += 2; break;
 			
-			case POP:case RET: case HALT:
-				if(op == POP) skipGR();
+			case POP:case RET: case HALT: case CLR:
+				if(op == POP || op == CLR) skipGR();
 				pc += 1; break;
 				
 			case READ: macro_read(); break;
@@ -365,6 +555,79 @@ buildCode(void)
 		if(token != ENDLINE) QUIT("指令错误");
 	} // while 循环结束
 	if(state != END) QUIT("缺少END指令");
+	if(lastOp != -1 && lastOp != HALT && lastOp != RET && lastOp != JMP)
+		WARN(lastLine, "最后一条指令不是HALT/RET/JMP, 程序会越过结尾继续执行");
+}
+
+/* 检查START的入口地址：必须在程序之内，并且不能是DC/DS定义的数据 */
+
+void
+chkEntry(void)
+{
+	unsigned short entry = (unsigned short)mem[pc_start + 1];
+	line = startLine;
+	if(entry >= pc) QUIT("入口地址超出程序范围");
+	if(isData[entry]) QUIT("入口地址位于DC/DS定义的数据区");
+}
+
+/* 诊断信息（-json 模式） */
+
+#define DIAG_MAX	64
+
+static struct {
+	const char *severity;
+	int line, column;
+	char message[LINESIZE*2];
+} diags[DIAG_MAX];
+static int ndiag = 0;
+
+void
+diagAdd(const char *severity, int ln, int col, const char *msg)
+{
+	if(ndiag >= DIAG_MAX) return;
+	diags[ndiag].severity = severity;
+	diags[ndiag].line = ln;
+	diags[ndiag].column = col;
+	strncpy(diags[ndiag].message, msg, sizeof(diags[ndiag].message)-1);
+	ndiag++;
+}
+
+static void
+jsonString(const char *s)
+{
+	putchar('"');
+	for(; *s; ++s) {
+		if(*s == '"' || *s == '\\') printf("\\%c", *s);
+		else if((unsigned char)*s < 0x20) printf("\\u%04x", *s);
+		else putchar(*s);
+	}
+	putchar('"');
+}
+
+void
+diagPrint(void)
+{
+	int i;
+	printf("[");
+	for(i = 0; i < ndiag; ++i) {
+		if(i > 0) printf(",");
+		printf("{\"line\":%d,\"column\":%d,\"severity\":",
+			diags[i].line, diags[i].column);
+		jsonString(diags[i].severity);
+		printf(",\"message\":");
+		jsonString(diags[i].message);
+		printf("}");
+	}
+	printf("]\n");
+	fflush(stdout);
+}
+
+void
+diagQuit(int ln, const char *msg)
+{
+	diagAdd("error", ln, tokPos, msg);
+	diagPrint();
+	exit(1);
 }
 
 void
@@ -373,10 +636,20 @@ init(int n, char *v[])
 	int len;
 	char *s;
 
-	printf("==================\n");
-	printf("CASL汇编语言编译器\n");
-	printf("==================\n\n");
-	if(n != 2) QUIT("命令 <文件>");
+	while(n > 2 && v[1][0] == '-') {
+		if(!strcmp(v[1], "-w")) noWarn = 1;
+		else if(!strcmp(v[1], "-json")) jsonOut = 1;
+		else if(!strcmp(v[1], "-map")) mapOut = 1;
+		else if(!strcmp(v[1], "-sym")) symOut = 1;
+		else break;
+		n--; v++;
+	}
+	if(!jsonOut) {
+		printf("==================\n");
+		printf("CASL汇编语言编译器\n");
+		printf("==================\n\n");
+	}
+	if(n != 2) QUIT("命令 [-w] [-json] [-map] [-sym] <文件>");
 	len = strlen(v[1]);
 	if(len > 16) QUIT("文件名太长");
 	strcpy(pgmName, v[1]);
@@ -386,8 +659,12 @@ init(int n, char *v[])
 		else *s = '\0';
 	}
 	strcpy(codName, pgmName);
+	strcpy(mapName, pgmName);
+	strcpy(symName, pgmName);
 	strcat(pgmName, ".casl");
 	strcat(codName, ".comet");
+	strcat(mapName, ".map");
+	strcat(symName, ".sym");
 	source = fopen(pgmName, "r");
 	if(source == NULL) QUIT("CASL程序不能打开");
 }
@@ -395,25 +672,54 @@ init(int n, char *v[])
 void
 chkLab(Label_T lab, void *cl)
 {
-	char msg[32];
+	char msg[LINESIZE+32];
 	if(lab == NULL || lab->datoff == NULL) return;
-	sprintf(msg, "错误信息：%-4d行 %s 标号没有定义\n", lab->addr, lab->key);
+	sprintf(msg, "%s 标号没有定义", lab->key);
+	line = lab->addr;
+	tokPos = 0;
 	QUIT(msg);
 }
 
+/* 标号表文件每行为：地址(十六进制) 标号，用TAB分隔 */
+
+void
+symLab(Label_T lab, void *cl)
+{
+	if(lab->datoff != NULL) return;
+	fprintf((FILE *)cl, "%04x\t%s\n", lab->addr, lab->key);
+}
+
+void
+symWrite(void)
+{
+	FILE *f;
+	if(!symOut) return;
+	f = fopen(symName, "w");
+	if(f == NULL) QUIT("标号表文件不能打开");
+	lab_map(symLab, f);
+	fclose(f);
+}
+
 void
 casl_free(void)
 {
 	off_t tmp[2];
 	lab_map(chkLab, NULL);
+	chkEntry();
 	code = fopen(codName, "wb");
 	if(code == NULL) QUIT("目标文件不能打开");
 	tmp[0] = (off_t)pc_start;
 	tmp[1] = (off_t)(pc -  pc_start);
 	fwrite(tmp, sizeof(off_t), NELEMS(tmp), code);
 	fwrite(&mem[tmp[0]], sizeof(off_t), tmp[1], code);
-	printf("输入文件 %s\n", pgmName);
-	printf("输出文件 %s\n", codName);
+	mapWrite();
+	symWrite();
+	if(jsonOut) {
+		diagPrint();
+	}else {
+		printf("输入文件 %s\n", pgmName);
+		printf("输出文件 %s\n", codName);
+	}
 	fclose(source);
 	fclose(code);
 	lab_free();
@@ -425,6 +731,7 @@ caslMain(int n, char *v[])
 	init(n, v);
 	buildCode();
 	casl_free();
+	fflush(stdout);
 	return 0;
 }
 
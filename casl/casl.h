@@ -27,12 +27,29 @@
 /* casl汇编程序的错误处理宏， msg为消息字符串 */
 
 #define QUIT(msg) do {	\
+	if(jsonOut) diagQuit(line, (msg));	\
 	printf("系统参数: %s 文件 %d 行\n", __FILE__, __LINE__);	\
 	printf("错误信息：%s 文件 %d 行 %s\n", pgmName, line, (msg));	\
 	printf("退出...\n\n");	\
 	exit(1);	\
 }while(0)
 
+/* casl汇编程序的警告处理宏， 不会终止汇编 */
+
+#define WARN(ln, msg) do {	\
+	if(noWarn) break;	\
+	if(jsonOut) diagAdd("warning", (ln), 0, (msg));	\
+	else printf("警告信息：%s 文件 %d 行 %s\n", pgmName, (ln), (msg));	\
+}while(0)
+
+/* -json 参数：错误和警告按JSON格式输出，方便编辑器使用
+   [{"line":行,"column":列,"severity":"error"或"warning","message":消息}] */
+
+extern int jsonOut;
+extern void diagAdd(const char *severity, int ln, int col, const char *msg);
+extern void diagPrint(void);
+extern void diagQuit(int ln, const char *msg);
+
 #define		MEMSIZE		0x10000		/* 内存大小	*/
 #define		pc_max		0xFB00		/* 最大地址	*/
 #define		sp_start	0xFB00		/* 栈地址	*/
@@ -86,8 +103,15 @@ typedef enum {
 	/* 汇编伪命令 */
 	START, END, DC, DS,
 	
+	/* 新增的机器指令（指令码见opCode）
+	   0x1B～0x1D 是字节指令(汇编器暂不支持) */
+	CLR, CMOVZ, TEST, ADDL, SUBL,
+	
 	/* 其他的标号 */
-	ID, NUM, STRING, COMMA, ENDLINE
+	ID, NUM, STRING, COMMA, ENDLINE, REG,
+	
+	/* 地址表达式的运算符 */
+	PLUS, MINUS, TIMES, LPAREN, RPAREN
 } TokenType;
 
 extern off_t mem[MEMSIZE];	/* 64k 内存 */
@@ -102,6 +126,8 @@ extern int line;		/* 行计数器 */
 
 extern int state;		/* 状态标志 */
 extern int Error;		/* 错误标志 */
+extern int noWarn;		/* 关闭警告 */
+extern int tokPos;		/* 记号开始的列 */
 
 
 extern int caslMain(int n, char *v[]);
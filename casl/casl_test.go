@@ -0,0 +1,261 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chai2010/tinylang/comet"
+)
+
+// 设置了这个环境变量时, 测试程序作为casl汇编器运行
+const caslTestEnv = "CASL_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(caslTestEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// 汇编结果
+type caslResult struct {
+	Output string   // 汇编器的输出
+	Failed bool     // 汇编失败
+	PC     int      // 入口地址
+	Code   []uint16 // 机器代码
+	Dir    string   // 工作目录(保存了映射文件等)
+}
+
+// 在临时目录中汇编t.casl, args是文件名之前的参数
+func runCasl(t *testing.T, src string, args ...string) *caslResult {
+	t.Helper()
+
+	var r = &caslResult{Dir: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(r.Dir, "t.casl"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], append(args, "t.casl")...)
+	cmd.Dir = r.Dir
+	cmd.Env = append(os.Environ(), caslTestEnv+"=1")
+	out, err := cmd.CombinedOutput()
+	r.Output = string(out)
+	if _, ok := err.(*exec.ExitError); ok {
+		r.Failed = true
+		return r
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.Dir, "t.comet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var words = make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	if len(words) < 2 || int(words[1]) != len(words)-2 {
+		t.Fatalf("目标文件格式错误: %04x", words)
+	}
+	r.PC, r.Code = int(words[0]), words[2:]
+	return r
+}
+
+func TestWarnMissingHalt(t *testing.T) {
+	const warn = "最后一条指令不是HALT/RET/JMP"
+
+	var tests = []struct {
+		src  string
+		args []string
+		warn bool
+	}{
+		{"\tSTART\n\tADD\tGR0,\tX\nX\tDC\t1\n\tEND\n", nil, true},
+		{"\tSTART\n\tADD\tGR0,\tX\n\tHALT\nX\tDC\t1\n\tEND\n", nil, false},
+		{"\tSTART\n\tADD\tGR0,\tX\nX\tDC\t1\n\tEND\n", []string{"-w"}, false},
+	}
+
+	for i, tt := range tests {
+		r := runCasl(t, tt.src, tt.args...)
+		if r.Failed {
+			t.Fatalf("%d: 汇编失败:\n%s", i, r.Output)
+		}
+		if got := strings.Contains(r.Output, warn); got != tt.warn {
+			t.Errorf("%d: 警告 = %v, 期望 %v:\n%s", i, got, tt.warn, r.Output)
+		}
+	}
+}
+
+func TestExprOperand(t *testing.T) {
+	r := runCasl(t, `	START
+	LEA	GR1,	TABLE+3
+	LD	GR2,	010
+	HALT
+A	DC	010
+B	DC	#10
+TABLE	DS	010
+C	DC	1
+	END
+`)
+	if r.Failed {
+		t.Fatalf("汇编失败:\n%s", r.Output)
+	}
+
+	// TABLE位于9, 0开头的数按十进制解析
+	var want = map[int]uint16{3: 9 + 3, 5: 10, 7: 10, 8: 0x10, 19: 1}
+	for adr, v := range want {
+		if adr >= len(r.Code) || r.Code[adr] != v {
+			t.Fatalf("mem[%d] 错误, 期望 %d: %v", adr, v, r.Code)
+		}
+	}
+	if len(r.Code) != 20 {
+		t.Fatalf("程序长度 %d, 期望 20", len(r.Code))
+	}
+
+	r = runCasl(t, "\tSTART\n\tLEA\tGR1,\tNOSUCH+1\n\tHALT\n\tEND\n")
+	if !r.Failed || !strings.Contains(r.Output, "NOSUCH 标号没有定义") {
+		t.Fatalf("没有报告未定义的标号:\n%s", r.Output)
+	}
+}
+
+func TestDataAroundCode(t *testing.T) {
+	r := runCasl(t, `	START	MAIN
+X	DC	3
+Y	DC	4
+MAIN	LD	GR0,	X
+	ADD	GR0,	Y
+	JMP	NEXT
+W	DS	2
+NEXT	ADD	GR0,	X
+	ST	GR0,	Z
+	HALT
+Z	DS	1
+	END
+`)
+	if r.Failed {
+		t.Fatalf("汇编失败:\n%s", r.Output)
+	}
+
+	// X位于2, MAIN位于4, W占用10~11, NEXT位于12, Z位于17
+	var want = map[int]uint16{1: 4, 2: 3, 3: 4, 9: 12}
+	for adr, v := range want {
+		if adr >= len(r.Code) || r.Code[adr] != v {
+			t.Fatalf("mem[%d] 错误, 期望 %d: %v", adr, v, r.Code)
+		}
+	}
+	if len(r.Code) != 18 {
+		t.Fatalf("程序长度 %d, 期望 18", len(r.Code))
+	}
+
+	p := comet.NewComet(r.Code, r.PC)
+	p.Stdout = new(bytes.Buffer)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GR[0] != 10 || p.Mem[17] != 10 {
+		t.Fatalf("GR0 = %d, mem[17] = %d, 期望 10", p.GR[0], p.Mem[17])
+	}
+
+	for _, tt := range []struct{ src, msg string }{
+		{"\tSTART\tX\nX\tDC\t1\n\tHALT\n\tEND\n", "入口地址位于DC/DS定义的数据区"},
+		{"\tSTART\tX+2\n\tHALT\nX\tDS\t1\n\tEND\n", "入口地址超出程序范围"},
+		{"X\tDC\t1\n\tSTART\n\tHALT\n\tEND\n", "缺少START指令"},
+	} {
+		r = runCasl(t, tt.src)
+		if !r.Failed || !strings.Contains(r.Output, tt.msg) {
+			t.Errorf("%q 没有报告 %q:\n%s", tt.src, tt.msg, r.Output)
+		}
+	}
+}
+
+func TestCLR(t *testing.T) {
+	r := runCasl(t, "\tSTART\n\tCLR\tGR1\n\tHALT\n\tEND\n")
+	if r.Failed {
+		t.Fatalf("汇编失败:\n%s", r.Output)
+	}
+	if len(r.Code) != 4 || r.Code[2] != uint16(comet.CLR)<<8|0x10 {
+		t.Fatalf("CLR GR1 的机器码错误: %04x", r.Code)
+	}
+}
+
+func TestCMOVZ(t *testing.T) {
+	r := runCasl(t, "\tSTART\n\tCMOVZ\tGR2,\tV,\tGR1\n\tHALT\nV\tDC\t9\n\tEND\n")
+	if r.Failed {
+		t.Fatalf("汇编失败:\n%s", r.Output)
+	}
+	if len(r.Code) != 6 || r.Code[2] != uint16(comet.CMOVZ)<<8|0x21 || r.Code[3] != 5 {
+		t.Fatalf("CMOVZ GR2, V, GR1 的机器码错误: %04x", r.Code)
+	}
+}
+
+func TestTEST(t *testing.T) {
+	r := runCasl(t, "\tSTART\n\tTEST\tGR1,\tM\n\tHALT\nM\tDC\t#000F\n\tEND\n")
+	if r.Failed {
+		t.Fatalf("汇编失败:\n%s", r.Output)
+	}
+	if len(r.Code) != 6 || r.Code[2] != uint16(comet.TEST)<<8|0x10 || r.Code[3] != 5 || r.Code[5] != 0x0F {
+		t.Fatalf("TEST GR1, M 的机器码错误: %04x", r.Code)
+	}
+}
+
+func TestJSONDiagnostics(t *testing.T) {
+	r := runCasl(t, "\tSTART\n\tLD\tGR1,\tNOSUCH\nX\tDC\t1\n\tEND\n", "-json")
+	if !r.Failed {
+		t.Fatalf("汇编没有失败:\n%s", r.Output)
+	}
+
+	var diags []struct {
+		Line     int    `json:"line"`
+		Column   int    `json:"column"`
+		Severity string `json:"severity"`
+		Message  string `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(r.Output), &diags); err != nil {
+		t.Fatalf("输出不是JSON: %v\n%s", err, r.Output)
+	}
+	if len(diags) != 2 ||
+		diags[0].Severity != "warning" || diags[0].Line != 2 || !strings.Contains(diags[0].Message, "HALT") ||
+		diags[1].Severity != "error" || diags[1].Line != 2 || diags[1].Message != "NOSUCH 标号没有定义" {
+		t.Fatalf("诊断信息错误: %+v", diags)
+	}
+}
+
+func TestErrorLabelContext(t *testing.T) {
+	for _, tt := range []struct{ src, msg string }{
+		{"\tSTART\nA\tLEA\tGR1,\t1\n\tHALT\nA\tDC\t1\n\tEND\n", "t.casl 文件 4 行 重复定义标号 A（第 2 行已经定义）"},
+		{"\tSTART\nA\tHALT\nB\tDS\t1\n\tDC\t70000\n\tEND\n", "t.casl 文件 4 行 表达式溢出: 70000（位于 B+1, 第 3 行定义）"},
+	} {
+		r := runCasl(t, tt.src)
+		if !r.Failed || !strings.Contains(r.Output, tt.msg) {
+			t.Errorf("%q 没有报告 %q:\n%s", tt.src, tt.msg, r.Output)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	r := runCasl(t, "\tSTART\nLOOP\tLEA\tGR1,\t1\n\tHALT\nX\tDC\t1\n\tEND\n", "-map")
+	if r.Failed {
+		t.Fatalf("汇编失败:\n%s", r.Output)
+	}
+
+	m, err := comet.LoadSourceMap(filepath.Join(r.Dir, "t.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 只有指令有映射
+	if len(m) != 2 || m[2] != (comet.SourceLine{Line: 2, Text: "LOOP\tLEA\tGR1,\t1"}) || m[4].Line != 3 {
+		t.Fatalf("映射错误: %v", m)
+	}
+}
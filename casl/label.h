@@ -12,6 +12,7 @@ typedef struct label {
 	struct label *link;
 	char *key;
 	int   addr;
+	int   defLine;	/* 定义所在的行 */
 	Stack_T datoff;
 } *Label_T;
 
@@ -38,13 +39,19 @@ lab_define(const char *key, int addr)
 		p = p->link;
 	}
 	if(p != NULL) {
-		if(p->datoff == NULL) QUIT("重复定义标号");
+		if(p->datoff == NULL) {
+			char msg[LINESIZE+64];
+			sprintf(msg, "重复定义标号 %s（第 %d 行已经定义）", key, p->defLine);
+			QUIT(msg);
+		}
+		/* 前向引用的位置已经保存了表达式的常数部分 */
 		while(!Stack_empty(p->datoff)) {
-			mem[Stack_pop(p->datoff)] = addr;
+			mem[Stack_pop(p->datoff)] += addr;
 		}
 		free(p->datoff);
 		p->datoff = NULL;
 		p->addr = addr;
+		p->defLine = line;
 	}else {
 		int len = strlen(key);
 		p = malloc(sizeof(*p) + len + 1);
@@ -53,6 +60,7 @@ lab_define(const char *key, int addr)
 		strcpy(p->key, key);
 		p->datoff = NULL;
 		p->addr = addr;
+		p->defLine = line;
 		p->link = buckets[h];
 		buckets[h] = p;
 	}
@@ -82,12 +90,41 @@ lab_get(const char *key, int off)
 		p->datoff = Stack_new();
 		Stack_push(p->datoff, off);
 		p->addr = line;
+		p->defLine = 0;
 		p->link = buckets[h];
 		buckets[h] = p;
 	}
 	return addr;
 }
 
+int
+lab_defined(const char *key)
+{
+	Label_T p = buckets[hash(key)];
+	while(p != NULL) {
+		if(!strcmp(key, p->key)) return p->datoff == NULL;
+		p = p->link;
+	}
+	return 0;
+}
+
+/* 地址之前最近的标号（用于错误信息），没有时返回NULL */
+
+Label_T
+lab_near(int addr)
+{
+	Label_T best = NULL;
+	int i;
+	for(i = 0; i < NELEMS(buckets); ++i) {
+		Label_T p;
+		for(p = buckets[i]; p != NULL; p = p->link) {
+			if(p->datoff != NULL || p->addr > addr) continue;
+			if(best == NULL || p->addr > best->addr) best = p;
+		}
+	}
+	return best;
+}
+
 void
 lab_map(void map(Label_T p, void *cl), void *cl)
 {
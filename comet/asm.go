@@ -0,0 +1,150 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 汇编一条机器指令(不支持标号和伪指令)
+//
+// 指令格式: OP GR, ADR[, XR] 或 OP ADR[, XR] 或 OP GR 或 OP,
+// 地址可以是十进制数或#开头的十六进制数.
+func AssembleInstruction(s string) ([]uint16, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, fmt.Errorf("空指令")
+	}
+
+	// 指令名和操作数
+	var name, args = s, ""
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		name, args = s[:i], strings.TrimSpace(s[i:])
+	}
+
+	op, ok := lookupOp(name)
+	if !ok {
+		return nil, fmt.Errorf("未知指令: %s", name)
+	}
+
+	var operands []string
+	if args != "" {
+		for _, x := range strings.Split(args, ",") {
+			operands = append(operands, strings.TrimSpace(x))
+		}
+	}
+
+	code, _, err := encodeInstruction(op, operands, parseAddr)
+	return code, err
+}
+
+// 编码一条机器指令(AssembleInstruction和Assemble共用)
+//
+// args是指令名之后的操作数, addr解析地址操作数(Assemble还支持标号).
+// 出错时同时返回出错的操作数的下标(-1表示指令本身), 用于给出错误的位置.
+func encodeInstruction(op OpType, args []string, addr func(s string) (uint16, error)) ([]uint16, int, error) {
+	// 系统调用: SYSCALL ID
+	if op == SYSCALL {
+		if len(args) != 1 {
+			return nil, -1, fmt.Errorf("%v: 缺少系统调用号", op)
+		}
+		id, err := parseAddr(args[0])
+		if err != nil || id > 0xFF {
+			return nil, 0, fmt.Errorf("%v: 无效的系统调用号 %s", op, args[0])
+		}
+		return []uint16{uint16(op)<<8 | id}, -1, nil
+	}
+
+	var code = []uint16{uint16(op) << 8}
+	var i = 0
+
+	// 通用寄存器
+	if op.UseGR() {
+		if len(args) == 0 {
+			return nil, -1, fmt.Errorf("%v: 缺少GR", op)
+		}
+		gr, err := parseGR(args[0])
+		if err != nil {
+			return nil, 0, fmt.Errorf("%v: %v", op, err)
+		}
+		code[0] |= gr << 4
+		i++
+	}
+
+	// 单字长指令
+	if op.Size() == 1 {
+		if len(args) > i {
+			return nil, i, fmt.Errorf("%v: 多余的操作数", op)
+		}
+		return code, -1, nil
+	}
+
+	// 地址和变址寄存器
+	if len(args) == i {
+		return nil, -1, fmt.Errorf("%v: 缺少地址", op)
+	}
+	if len(args) > i+2 {
+		return nil, i + 2, fmt.Errorf("%v: 多余的操作数", op)
+	}
+	adr, err := addr(args[i])
+	if err != nil {
+		return nil, i, fmt.Errorf("%v: %v", op, err)
+	}
+	if len(args) == i+2 {
+		xr, err := parseGR(args[i+1])
+		if err != nil {
+			return nil, i + 1, fmt.Errorf("%v: %v", op, err)
+		}
+		if xr == 0 {
+			return nil, i + 1, fmt.Errorf("%v: GR0不能作为XR", op)
+		}
+		code[0] |= xr
+	}
+	return append(code, adr), -1, nil
+}
+
+// 查找指令名
+func lookupOp(name string) (OpType, bool) {
+	name = strings.ToUpper(name)
+	for i, v := range OpTab {
+		if v.Name != "" && v.Name == name {
+			return OpType(i), true
+		}
+	}
+	return 0, false
+}
+
+// 解析寄存器(GR和XR都使用这个函数)
+//
+// GR0 ~ GR7 是标准的寄存器名, 虚拟机目前只实现了 GR0 ~ GR4.
+func parseGR(s string) (uint16, error) {
+	s = strings.ToUpper(s)
+	if len(s) != 3 || !strings.HasPrefix(s, "GR") || s[2] < '0' || s[2] > '7' {
+		return 0, fmt.Errorf("无效的寄存器 %s", s)
+	}
+	if gr := uint16(s[2] - '0'); gr < uint16(len(CPU{}.GR)) {
+		return gr, nil
+	}
+	return 0, fmt.Errorf("虚拟机没有实现寄存器 %s (只有GR0 ~ GR4)", s)
+}
+
+// 解析地址(十进制或#开头的十六进制)
+func parseAddr(s string) (uint16, error) {
+	if strings.HasPrefix(s, "#") {
+		v, err := strconv.ParseUint(s[1:], 16, 16)
+		if err != nil {
+			return 0, fmt.Errorf("无效的地址 %s", s)
+		}
+		return uint16(v), nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < -32768 || v > 65535 {
+		return 0, fmt.Errorf("无效的地址 %s", s)
+	}
+	return uint16(v), nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssembleRegisterNames(t *testing.T) {
+	code, err := AssembleInstruction("LD GR3,#10,GR2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code[0] != uint16(LD)<<8|0x32 || code[1] != 0x10 {
+		t.Fatalf("LD GR3,#10,GR2 = %04x, 期望 0132 0010", code)
+	}
+
+	for _, tt := range []struct {
+		src, err string
+	}{
+		{"LD GR8,1", "无效的寄存器 GR8"},
+		{"LD GR1,1,GR8", "无效的寄存器 GR8"},
+		{"LD GR5,1", "虚拟机没有实现寄存器 GR5"},
+		{"LD GR1,1,GR7", "虚拟机没有实现寄存器 GR7"},
+	} {
+		if _, err := AssembleInstruction(tt.src); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: err = %v, 期望 %q", tt.src, err, tt.err)
+		}
+
+		// 汇编器使用相同的寄存器名解析
+		src := "MAIN START\n     " + tt.src + "\n     END"
+		if _, _, err := Assemble(src); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Assemble %s: err = %v, 期望 %q", tt.src, err, tt.err)
+		}
+	}
+}
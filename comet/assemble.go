@@ -0,0 +1,329 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 汇编错误(行号和列号从1开始)
+type AsmError struct {
+	Line int
+	Col  int
+	Msg  string
+}
+
+func (e *AsmError) Error() string {
+	return fmt.Sprintf("第 %d 行第 %d 列: %s", e.Line, e.Col, e.Msg)
+}
+
+// 汇编CASL的子集, 返回程序(从0地址开始)和入口地址
+//
+// 每行格式为: [标号] 指令 [操作数, ...] [; 注释], 标号从第一列开始.
+// 支持全部机器指令和START, END, DC, DS伪指令(不支持READ, WRITE等宏指令);
+// 地址可以是标号, 十进制数或#开头的十六进制数, DC还可以是'字符串'.
+// START的操作数是入口标号, 没有时入口为START之后的第一条语句.
+func Assemble(src string) ([]int16, int, error) {
+	var stmts []*asmStmt
+	var labels = make(map[string]int)
+	var entry *asmField
+	var pc, start = 0, -1
+
+	// 第一遍: 解析每行, 计算标号的地址
+	for i, line := range strings.Split(src, "\n") {
+		s, err := parseAsmLine(i+1, line)
+		if err != nil {
+			return nil, 0, err
+		}
+		if s == nil {
+			continue
+		}
+		if s.label != nil {
+			if _, ok := labels[s.label.text]; ok {
+				return nil, 0, s.label.errorf("重复定义的标号 %s", s.label.text)
+			}
+			labels[s.label.text] = pc
+		}
+
+		switch s.name {
+		case "START":
+			if len(s.args) > 1 {
+				return nil, 0, s.args[1].errorf("START: 多余的操作数")
+			}
+			if len(s.args) == 1 {
+				entry = &s.args[0]
+			}
+			start = pc
+			continue
+		case "END":
+			if len(s.args) != 0 {
+				return nil, 0, s.args[0].errorf("END: 多余的操作数")
+			}
+		case "DC":
+			if len(s.args) == 0 {
+				return nil, 0, s.opErrorf("DC: 缺少常数")
+			}
+			for _, a := range s.args {
+				pc += a.dcSize()
+			}
+		case "DS":
+			if len(s.args) != 1 {
+				return nil, 0, s.opErrorf("DS: 需要一个操作数")
+			}
+			n, err := strconv.Atoi(s.args[0].text)
+			if err != nil || n < 0 {
+				return nil, 0, s.args[0].errorf("DS: 无效的字数 %s", s.args[0].text)
+			}
+			pc += n
+		default:
+			op, ok := lookupOp(s.name)
+			if !ok {
+				return nil, 0, s.opErrorf("未知指令: %s", s.name)
+			}
+			s.op = op
+			pc += int(op.Size())
+		}
+		if s.name == "END" {
+			break
+		}
+		if pc > PC_MAX {
+			return nil, 0, s.opErrorf("程序太大")
+		}
+		stmts = append(stmts, s)
+	}
+
+	// 第二遍: 生成代码
+	var prog []int16
+	for _, s := range stmts {
+		var code []uint16
+		var err error
+		switch s.name {
+		case "DC":
+			code, err = s.assembleDC(labels)
+		case "DS":
+			n, _ := strconv.Atoi(s.args[0].text)
+			code = make([]uint16, n)
+		default:
+			code, err = s.assembleOp(labels)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, w := range code {
+			prog = append(prog, int16(w))
+		}
+	}
+
+	switch {
+	case entry != nil:
+		adr, ok := labels[entry.text]
+		if !ok {
+			return nil, 0, entry.errorf("未定义的标号 %s", entry.text)
+		}
+		return prog, adr, nil
+	case start >= 0:
+		return prog, start, nil
+	}
+	return prog, 0, nil
+}
+
+// 一个字段(标号, 指令名或操作数)和它的位置
+type asmField struct {
+	text string
+	line int
+	col  int
+}
+
+func (f *asmField) errorf(format string, a ...interface{}) error {
+	return &AsmError{Line: f.line, Col: f.col, Msg: fmt.Sprintf(format, a...)}
+}
+
+// DC操作数占用的字数
+func (f *asmField) dcSize() int {
+	if s, ok := f.quoted(); ok {
+		return len([]rune(s))
+	}
+	return 1
+}
+
+// '字符串'的内容
+func (f *asmField) quoted() (string, bool) {
+	if len(f.text) >= 2 && f.text[0] == '\'' && f.text[len(f.text)-1] == '\'' {
+		return f.text[1 : len(f.text)-1], true
+	}
+	return "", false
+}
+
+// 地址: 标号, 十进制数或#开头的十六进制数
+func (f *asmField) addr(labels map[string]int) (uint16, error) {
+	v, err := resolveAddr(labels, f.text)
+	if err != nil {
+		return 0, f.errorf("%v", err)
+	}
+	return v, nil
+}
+
+// 解析地址, 先查找标号
+func resolveAddr(labels map[string]int, s string) (uint16, error) {
+	if adr, ok := labels[s]; ok {
+		return uint16(adr), nil
+	}
+	if isAsmLabel(s) {
+		return 0, fmt.Errorf("未定义的标号 %s", s)
+	}
+	return parseAddr(s)
+}
+
+// 一条语句
+type asmStmt struct {
+	label *asmField
+	name  string // 指令名(大写)
+	nameF asmField
+	args  []asmField
+
+	op OpType
+}
+
+func (s *asmStmt) opErrorf(format string, a ...interface{}) error {
+	return s.nameF.errorf(format, a...)
+}
+
+// 汇编机器指令
+func (s *asmStmt) assembleOp(labels map[string]int) ([]uint16, error) {
+	var args = make([]string, len(s.args))
+	for i, a := range s.args {
+		args[i] = a.text
+	}
+	code, i, err := encodeInstruction(s.op, args, func(x string) (uint16, error) {
+		return resolveAddr(labels, x)
+	})
+	switch {
+	case err == nil:
+		return code, nil
+	case i < 0:
+		return nil, s.opErrorf("%v", err)
+	default:
+		return nil, s.args[i].errorf("%v", err)
+	}
+}
+
+// 汇编DC常数
+func (s *asmStmt) assembleDC(labels map[string]int) ([]uint16, error) {
+	var code []uint16
+	for _, a := range s.args {
+		if str, ok := a.quoted(); ok {
+			for _, r := range str {
+				code = append(code, uint16(r))
+			}
+			continue
+		}
+		v, err := a.addr(labels)
+		if err != nil {
+			return nil, err
+		}
+		code = append(code, v)
+	}
+	return code, nil
+}
+
+// 解析一行, 空行和注释行返回nil
+func parseAsmLine(lineno int, line string) (*asmStmt, error) {
+	line = strings.TrimRight(stripAsmComment(line), " \t\r")
+	if strings.TrimSpace(line) == "" {
+		return nil, nil
+	}
+
+	var s = new(asmStmt)
+	var pos = 0
+	var next = func() (asmField, bool) {
+		for pos < len(line) && (line[pos] == ' ' || line[pos] == '\t') {
+			pos++
+		}
+		var begin = pos
+		for pos < len(line) && line[pos] != ' ' && line[pos] != '\t' {
+			pos++
+		}
+		return asmField{text: line[begin:pos], line: lineno, col: begin + 1}, begin < pos
+	}
+
+	// 标号从第一列开始
+	if line[0] != ' ' && line[0] != '\t' {
+		f, _ := next()
+		if !isAsmLabel(f.text) {
+			return nil, f.errorf("无效的标号 %s", f.text)
+		}
+		s.label = &f
+	}
+
+	f, ok := next()
+	if !ok {
+		return nil, s.label.errorf("标号 %s 之后缺少指令", s.label.text)
+	}
+	s.nameF, s.name = f, strings.ToUpper(f.text)
+
+	// 操作数用逗号分隔(字符串中的逗号除外)
+	var rest = line[pos:]
+	if strings.TrimSpace(rest) == "" {
+		return s, nil
+	}
+	var begin, quote = 0, false
+	for i := 0; i <= len(rest); i++ {
+		if i < len(rest) && rest[i] == '\'' {
+			quote = !quote
+		}
+		if i < len(rest) && (quote || rest[i] != ',') {
+			continue
+		}
+
+		var text = rest[begin:i]
+		var col = pos + begin + 1 + (len(text) - len(strings.TrimLeft(text, " \t")))
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, &AsmError{Line: lineno, Col: col, Msg: "缺少操作数"}
+		}
+		s.args = append(s.args, asmField{text: text, line: lineno, col: col})
+		begin = i + 1
+	}
+	if quote {
+		return nil, s.args[len(s.args)-1].errorf("字符串缺少结束的引号")
+	}
+	return s, nil
+}
+
+// 去掉分号之后的注释(字符串中的分号除外)
+func stripAsmComment(line string) string {
+	var quote = false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\'':
+			quote = !quote
+		case ';':
+			if !quote {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// 标号: 字母开头, 由字母, 数字和下划线组成, 不能是寄存器名(GR0 ~ GR7)
+func isAsmLabel(s string) bool {
+	if s == "" || !isAsmLetter(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isAsmLetter(s[i]) && (s[i] < '0' || s[i] > '9') {
+			return false
+		}
+	}
+	var u = strings.ToUpper(s)
+	return !(len(u) == 3 && strings.HasPrefix(u, "GR") && u[2] >= '0' && u[2] <= '7')
+}
+
+func isAsmLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	prog, entry, err := Assemble(`; 注释行
+MAIN START ENTRY
+BUF  DS   2
+MSG  DC   'a;b', #FFFF, -1, BUF
+ENTRY LD  GR1,MSG,GR2  ; 行尾注释
+     SYSCALL 3
+     POP  GR3
+     JMP  ENTRY
+     END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var code = make([]uint16, len(prog))
+	for i, v := range prog {
+		code[i] = uint16(v)
+	}
+	var want = []uint16{
+		0, 0, // BUF
+		'a', ';', 'b', 0xFFFF, 0xFFFF, 0, // MSG
+		uint16(LD)<<8 | 0x12, 2,
+		uint16(SYSCALL)<<8 | 3,
+		uint16(POP)<<8 | 0x30,
+		uint16(JMP) << 8, 8,
+	}
+	if entry != 8 || !reflect.DeepEqual(code, want) {
+		t.Fatalf("entry = %d, prog = %04x\n期望 8, %04x", entry, code, want)
+	}
+
+	// 机器指令和AssembleInstruction的编码相同
+	for _, s := range []string{"LD GR3,#10,GR2", "ADD GR1,100", "SYSCALL 255", "RET", "PUSH 5,GR1", "POP GR2"} {
+		code, err := AssembleInstruction(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog, _, err := Assemble("MAIN START\n     " + s + "\n     END")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, w := range code {
+			if i >= len(prog) || uint16(prog[i]) != w {
+				t.Errorf("%s: Assemble = %04x, AssembleInstruction = %04x", s, prog, code)
+				break
+			}
+		}
+	}
+}
+
+func TestAssembleError(t *testing.T) {
+	for _, tt := range []struct {
+		src       string
+		line, col int
+		msg       string
+	}{
+		{"     LD   GR1,X", 2, 15, "LD: 未定义的标号 X"},
+		{"     LD   GR1", 2, 6, "LD: 缺少地址"},
+		{"     LD   GR1,1,GR2,3", 2, 21, "LD: 多余的操作数"},
+		{"     LD   GR1,1,GR0", 2, 17, "LD: GR0不能作为XR"},
+		{"     RET  GR1", 2, 11, "RET: 多余的操作数"},
+		{"     SYSCALL 256", 2, 14, "SYSCALL: 无效的系统调用号 256"},
+		{"     FOO  GR1", 2, 6, "未知指令: FOO"},
+		{"L    HALT\nL    HALT", 3, 1, "重复定义的标号 L"},
+	} {
+		_, _, err := Assemble("MAIN START\n" + tt.src + "\n     END")
+		var e *AsmError
+		if !errors.As(err, &e) {
+			t.Errorf("%q: err = %v", tt.src, err)
+			continue
+		}
+		if e.Line != tt.line || e.Col != tt.col || e.Msg != tt.msg {
+			t.Errorf("%q: %v, 期望 第 %d 行第 %d 列: %s", tt.src, e, tt.line, tt.col, tt.msg)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 调试器的断言: 每条指令执行之后检查, 违反时停止运行
+//
+// 格式为 `寄存器 比较符 值`, 比如 `GR0 == 0`.
+// 寄存器可以是 GR0 ~ GR4, PC, FR, SP; 比较符为 ==, !=, <, <=, >, >=.
+// ==和!=按16位无符号数比较, 其余按16位有符号数比较.
+type debugAssert struct {
+	Reg   string
+	Op    string
+	Value uint16
+}
+
+// 解析断言(数值按radix进制)
+func parseAssert(s string, radix int) (*debugAssert, error) {
+	var fields = strings.Fields(s)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("断言格式为: 寄存器 比较符 值")
+	}
+
+	var a = &debugAssert{Reg: strings.ToUpper(fields[0]), Op: fields[1]}
+	if _, err := parseGR(a.Reg); err != nil && a.Reg != "PC" && a.Reg != "FR" && a.Reg != "SP" {
+		return nil, fmt.Errorf("无效的寄存器 %s", fields[0])
+	}
+	switch a.Op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("无效的比较符 %s", a.Op)
+	}
+
+	v, err := strconv.ParseInt(fields[2], radix, 32)
+	if err != nil || v < -32768 || v > 0xFFFF {
+		return nil, fmt.Errorf("无效的值 %s", fields[2])
+	}
+	a.Value = uint16(v)
+
+	return a, nil
+}
+
+// 检查断言是否成立
+func (a *debugAssert) Check(p *Comet) bool {
+	x, _ := p.regValue(a.Reg)
+	switch a.Op {
+	case "==":
+		return x == a.Value
+	case "!=":
+		return x != a.Value
+	case "<":
+		return int16(x) < int16(a.Value)
+	case "<=":
+		return int16(x) <= int16(a.Value)
+	case ">":
+		return int16(x) > int16(a.Value)
+	case ">=":
+		return int16(x) >= int16(a.Value)
+	}
+	return true
+}
+
+func (a *debugAssert) String() string {
+	return fmt.Sprintf("%s %s %04x", a.Reg, a.Op, a.Value)
+}
+
+// 按名字读取寄存器
+func (p *Comet) regValue(name string) (uint16, bool) {
+	switch name {
+	case "PC":
+		return p.PC, true
+	case "FR":
+		return uint16(p.FR), true
+	case "SP":
+		return p.GR[4], true
+	}
+	if gr, err := parseGR(name); err == nil {
+		return p.GR[gr], true
+	}
+	return 0, false
+}
+
+// 检查全部断言, 返回第一个不成立的断言
+func (p *Comet) checkAsserts(asserts []*debugAssert) *debugAssert {
+	for _, a := range asserts {
+		if !a.Check(p) {
+			return a
+		}
+	}
+	return nil
+}
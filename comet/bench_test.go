@@ -0,0 +1,63 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"testing"
+)
+
+// 以LEA为主的循环, 指令本身的开销很小, 主要是解码和分派的开销
+const benchLoopSrc = `MAIN START
+L    LEA  GR1,1,GR1
+     LEA  GR2,1,GR2
+     LEA  GR3,1,GR3
+     LEA  GR1,1,GR1
+     LEA  GR2,1,GR2
+     LEA  GR3,1,GR3
+     LEA  GR1,1,GR1
+     JMP  L
+     END`
+
+// 汇编benchLoopSrc并创建虚拟机
+func newBenchComet(b *testing.B) *Comet {
+	prog, entry, err := Assemble(benchLoopSrc)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var code = make([]uint16, len(prog))
+	for i, v := range prog {
+		code[i] = uint16(v)
+	}
+	return NewComet(code, entry)
+}
+
+// 解码和分派的开销(每次一条指令), 改为分派表时用来比较两种实现的ns/op
+func BenchmarkStep(b *testing.B) {
+	p := newBenchComet(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := p.StepRun(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if p.Shutdown {
+		b.Fatal("循环停机了")
+	}
+}
+
+// 只有解码的开销
+func BenchmarkDecode(b *testing.B) {
+	p := newBenchComet(b)
+	var pcs []uint16
+	for pc := 0; pc < p.progSize; pc += InstrLen(int16(p.Mem[pc])) {
+		pcs = append(pcs, uint16(pc))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := p.ParseInstruction(pcs[i%len(pcs)]); !ok {
+			b.Fatal("无法解码")
+		}
+	}
+}
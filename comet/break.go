@@ -0,0 +1,36 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"sort"
+)
+
+// 设置断点(调试器的go命令运行到该地址时暂停)
+func (p *Comet) SetBreakpoint(adr uint16) {
+	if p.breakpoints == nil {
+		p.breakpoints = make(map[uint16]bool)
+	}
+	p.breakpoints[adr] = true
+}
+
+// 删除断点, 返回断点是否存在
+func (p *Comet) ClearBreakpoint(adr uint16) bool {
+	if !p.breakpoints[adr] {
+		return false
+	}
+	delete(p.breakpoints, adr)
+	return true
+}
+
+// 返回全部断点(按地址排序)
+func (p *Comet) Breakpoints() []uint16 {
+	var list = make([]uint16, 0, len(p.breakpoints))
+	for adr := range p.breakpoints {
+		list = append(list, adr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
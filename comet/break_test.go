@@ -0,0 +1,68 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebugBreak(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,0
+L    LEA  GR1,1,GR1
+     CPA  GR1,TEN
+     JNZ  L
+     HALT
+TEN  DC   10
+     END`)
+	out := runDebug(p, "break 2\ninfo break\ng\nregs\nc\ninfo break\ng\ndelete 2\ninfo break\ng\nq\n")
+
+	for _, want := range []string{
+		"设置断点 0002\n",
+		"断点 0002\n",
+		"GR[1] = 0000",
+		"删除断点 0002\n",
+		"没有断点\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+	// 断点在clear之后保留, 删除之后运行到停机
+	if n := strings.Count(out, ": 断点 0002\n"); n != 4 {
+		t.Errorf("断点 0002 出现 %d 次, 期望 4 次:\n%s", n, out)
+	}
+	if !p.Shutdown || p.GR[1] != 10 || len(p.Breakpoints()) != 0 {
+		t.Errorf("删除断点之后没有运行到停机: GR1 = %d", p.GR[1])
+	}
+}
+
+func TestDebugGoN(t *testing.T) {
+	const src = `MAIN START
+     LEA  GR1,0
+L    LEA  GR1,1,GR1
+     CPA  GR1,FIVE
+     JNZ  L
+     HALT
+FIVE DC   5
+     END`
+
+	p, _ := newTestComet(t, src)
+	out := runDebug(p, "break 4\ngo 3\nq\n")
+	if !strings.Contains(out, "断点 0004 (第 2 次, 继续运行)\n") || !strings.Contains(out, "继续运行)\n断点 0004\n") {
+		t.Fatalf("go 3 没有在第3次遇到断点时暂停:\n%s", out)
+	}
+	if p.Shutdown || p.PC != 4 || p.GR[1] != 3 {
+		t.Fatalf("PC = %04x, GR1 = %d, 期望停在第3次循环", p.PC, p.GR[1])
+	}
+
+	// 断点次数不够时运行到停机
+	p, _ = newTestComet(t, src)
+	runDebug(p, "break 4\ngo 10\nq\n")
+	if !p.Shutdown || p.GR[1] != 5 {
+		t.Fatalf("GR1 = %d, 没有运行到停机", p.GR[1])
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 缓存模型(用于体系结构教学, 默认不使用)
+//
+// 每次数据读写内存时调用Access, 返回额外的时钟周期数(命中一般为0).
+// 指令的读取不经过缓存.
+type Cache interface {
+	Access(adr uint16, write bool) int
+}
+
+// 直接映射缓存
+//
+// 可以直接使用结构体(零值为1行1字), Lines和LineSize小于1时按1处理.
+// 修改Lines之后的第一次访问会清空缓存行.
+type DirectMappedCache struct {
+	Lines       int // 缓存行数目
+	LineSize    int // 每行的字数
+	MissPenalty int // 未命中时额外的时钟周期
+
+	Hits   int64 // 命中次数
+	Misses int64 // 未命中次数
+
+	tags  []int
+	valid []bool
+}
+
+// 创建直接映射缓存
+func NewDirectMappedCache(lines, lineSize, missPenalty int) *DirectMappedCache {
+	if lines <= 0 {
+		lines = 1
+	}
+	if lineSize <= 0 {
+		lineSize = 1
+	}
+	return &DirectMappedCache{
+		Lines:       lines,
+		LineSize:    lineSize,
+		MissPenalty: missPenalty,
+	}
+}
+
+// 访问adr地址, 未命中时装入对应的缓存行(写操作同样装入)
+func (p *DirectMappedCache) Access(adr uint16, write bool) int {
+	var lines, lineSize = p.Lines, p.LineSize
+	if lines < 1 {
+		lines = 1
+	}
+	if lineSize < 1 {
+		lineSize = 1
+	}
+	if len(p.valid) != lines {
+		p.tags, p.valid = make([]int, lines), make([]bool, lines)
+	}
+
+	var block = int(adr) / lineSize
+	var line, tag = block % lines, block / lines
+
+	if p.valid[line] && p.tags[line] == tag {
+		p.Hits++
+		return 0
+	}
+
+	p.Misses++
+	p.valid[line], p.tags[line] = true, tag
+	return p.MissPenalty
+}
+
+// 清空缓存和统计数据
+func (p *DirectMappedCache) Reset() {
+	for i := range p.valid {
+		p.valid[i] = false
+	}
+	p.Hits, p.Misses = 0, 0
+}
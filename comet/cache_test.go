@@ -0,0 +1,53 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"testing"
+)
+
+func TestDirectMappedCacheStride(t *testing.T) {
+	// 4行, 每行4字, 每种访问模式执行两遍
+	for _, tt := range []struct {
+		stride, n int
+		misses    int64
+	}{
+		{1, 16, 4},  // 顺序访问: 每行只有第一次未命中
+		{4, 4, 4},   // 每次一个新的行, 第二遍全部命中
+		{16, 4, 8},  // 都映射到第0行, 互相替换
+		{4, 16, 32}, // 64字超过缓存大小, 第二遍时已被替换
+	} {
+		c := NewDirectMappedCache(4, 4, 10)
+		var cycles int
+		for pass := 0; pass < 2; pass++ {
+			for i := 0; i < tt.n; i++ {
+				cycles += c.Access(uint16(i*tt.stride), false)
+			}
+		}
+		if c.Misses != tt.misses || c.Hits+c.Misses != int64(2*tt.n) || cycles != int(tt.misses)*10 {
+			t.Errorf("步长 %d: 未命中 %d 次, 命中 %d 次, 代价 %d, 期望未命中 %d 次",
+				tt.stride, c.Misses, c.Hits, cycles, tt.misses)
+		}
+	}
+}
+
+func TestDirectMappedCacheZero(t *testing.T) {
+	// 零值按1行1字处理
+	var c DirectMappedCache
+	c.Access(0, false)
+	c.Access(0, true)
+	c.Access(1, false)
+	if c.Hits != 1 || c.Misses != 2 {
+		t.Fatalf("命中 %d 次, 未命中 %d 次, 期望 1, 2", c.Hits, c.Misses)
+	}
+
+	// 修改行数之后重新分配缓存行
+	c.Lines, c.LineSize = 8, 2
+	c.Access(15, false)
+	c.Access(14, false)
+	if c.Hits != 2 || c.Misses != 3 {
+		t.Fatalf("命中 %d 次, 未命中 %d 次, 期望 2, 3", c.Hits, c.Misses)
+	}
+}
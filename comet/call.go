@@ -0,0 +1,62 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+)
+
+// 子程序返回时的哨兵地址(位于系统保留区, 程序不会跳转到这里)
+const CALL_SENTINEL = PC_MAX
+
+// 调用addr位置的子程序, 返回GR0的值
+//
+// 参数依次放入GR0 ~ GR3, 然后压入哨兵返回地址, 运行到子程序返回哨兵地址为止.
+// maxSteps是最多执行的指令数目(小于等于0表示不限制).
+// 子程序停机, 异常或者超过指令数目时返回错误.
+func (p *Comet) CallSubroutine(addr int, args []int16, maxSteps int) (int16, error) {
+	if addr < 0 || addr >= PC_MAX {
+		return 0, fmt.Errorf("无效的子程序地址：%x", addr)
+	}
+	if len(args) > 4 {
+		return 0, fmt.Errorf("参数太多：%d (最多4个)", len(args))
+	}
+	if p.GR[4] == 0 {
+		return 0, ErrStackUninitialized
+	}
+
+	for i, v := range args {
+		p.GR[i] = uint16(v)
+	}
+
+	p.PC = uint16(addr)
+	p.Shutdown = false
+	p.err = nil
+
+	// 和CALL指令一样压入返回地址(检查栈溢出, 经过零页保护和缓存模型)
+	var sp = p.GR[4]
+	p.spInitialized = true
+	if !p.checkPush() || !p.writeMem(sp-1, CALL_SENTINEL) {
+		return 0, p.err
+	}
+	p.GR[4]--
+	p.callDepth++
+
+	for steps := 0; ; steps++ {
+		if p.PC == CALL_SENTINEL && p.GR[4] == sp {
+			return int16(p.GR[0]), nil
+		}
+		if maxSteps > 0 && steps >= maxSteps {
+			return 0, fmt.Errorf("子程序 %x 超过 %d 条指令没有返回", addr, maxSteps)
+		}
+
+		if err := p.StepRun(); err != nil {
+			return 0, err
+		}
+		if p.Shutdown {
+			return 0, fmt.Errorf("子程序 %x 没有返回就停机了", addr)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCallSubroutine(t *testing.T) {
+	const src = `MAIN START
+     HALT
+DBL  SLA  GR0,ONE
+     RET
+ONE  DC   1
+     END`
+
+	p, _ := newTestComet(t, src)
+	for _, v := range []int16{21, -3, 0} {
+		got, err := p.CallSubroutine(1, []int16{v}, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != v*2 {
+			t.Fatalf("DBL(%d) = %d, 期望 %d", v, got, v*2)
+		}
+		if p.GR[4] != SP_START || p.CallDepth() != 0 {
+			t.Fatalf("返回之后 SP = %x, 调用深度 %d", p.GR[4], p.CallDepth())
+		}
+	}
+
+	// 返回地址和CALL指令一样经过零页保护
+	prog, entry := assembleTest(t, src)
+	p = NewComet(prog, entry, WithSP(0x10))
+	p.StackFloor = 1
+	p.ZeroPageProtect, p.ZeroPageSize = true, 0x100
+	_, err := p.CallSubroutine(1, []int16{1}, 100)
+	wantFault(t, err, FaultZeroPage)
+}
+
+func TestDebugDepth(t *testing.T) {
+	// F递归调用自己, 在第3层到达LEAF; PUSH的数据不计入调用深度
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,3
+     CALL P
+     HALT
+F    PUSH 0,GR1
+     LEA  GR1,-1,GR1
+     JZE  LEAF
+     CALL P
+     POP  GR1
+     RET
+LEAF POP  GR1
+     RET
+P    DC   F
+     END`)
+	out := runDebug(p, "depth\nbreak f\ng\ndepth\ng\ndepth\nq\n")
+	for _, want := range []string{
+		"调用深度 = 0 （栈中共有 0 个数据）\n",
+		"断点 000f\n",
+		"调用深度 = 3 （栈中共有 6 个数据）\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+	if !p.Shutdown || p.CallDepth() != 0 || strings.Count(out, "调用深度 = 0 （栈中共有 0 个数据）\n") != 2 {
+		t.Fatalf("停机之后 调用深度 %d:\n%s", p.CallDepth(), out)
+	}
+}
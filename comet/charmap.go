@@ -0,0 +1,48 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 字符集: 字符IO时字和字符的转换
+//
+// 内置的IN/OUT系统调用和IO外设的字符类型传输都通过Comet.CharMap转换,
+// 没有设置时按ASCII(字的值就是字符的编码)处理.
+type CharMap interface {
+	Rune(w uint16) rune // 字转为输出的字符
+	Word(r rune) uint16 // 输入的字符转为字
+}
+
+// ASCII字符集(字的值就是字符的编码)
+type ASCIIMap struct{}
+
+func (ASCIIMap) Rune(w uint16) rune { return rune(w) }
+func (ASCIIMap) Word(r rune) uint16 { return uint16(r) }
+
+// 查表的字符集, 表中没有的字按ASCII处理
+type TableCharMap map[uint16]rune
+
+func (m TableCharMap) Rune(w uint16) rune {
+	if r, ok := m[w]; ok {
+		return r
+	}
+	return rune(w)
+}
+
+// 多个字对应同一个字符时返回最小的字(不依赖map的遍历顺序)
+func (m TableCharMap) Word(r rune) uint16 {
+	var word, found = uint16(r), false
+	for w, v := range m {
+		if v == r && (!found || w < word) {
+			word, found = w, true
+		}
+	}
+	return word
+}
+
+func (p *Comet) charMap() CharMap {
+	if p.CharMap != nil {
+		return p.CharMap
+	}
+	return ASCIIMap{}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestCharMap(t *testing.T) {
+	const src = `MAIN START
+     LEA  GR0,BUF
+     LEA  GR1,1
+     SYSCALL 3
+     LEA  GR0,S
+     LEA  GR1,3
+     SYSCALL 4
+     HALT
+S    DC   1
+     DC   65
+BUF  DS   1
+     END`
+
+	for _, tt := range []struct {
+		m   CharMap
+		out string
+		in  uint16
+	}{
+		{nil, "\x01Aあ", 'あ'},
+		{TableCharMap{1: 'あ'}, "あAあ", 1},
+	} {
+		p, out := newTestComet(t, src)
+		p.CharMap = tt.m
+		p.Stdin = bufio.NewReader(strings.NewReader("あ"))
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.out || p.Mem[13] != tt.in {
+			t.Fatalf("CharMap = %v: 输出 %q, 输入 %04x, 期望 %q, %04x", tt.m, out, p.Mem[13], tt.out, tt.in)
+		}
+	}
+}
+
+func TestTableCharMapWord(t *testing.T) {
+	// 全角和半角的片假名都显示为ア, 输入时总是转为较小的字
+	var m = TableCharMap{0xB1: 'ア', 0x2522: 'ア', 0x2524: 'イ'}
+	for i := 0; i < 10; i++ {
+		if w := m.Word('ア'); w != 0xB1 {
+			t.Fatalf("Word('ア') = %04x, 期望 00b1", w)
+		}
+	}
+	if w := m.Word('A'); w != 'A' {
+		t.Fatalf("Word('A') = %04x, 期望按ASCII处理", w)
+	}
+}
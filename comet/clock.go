@@ -0,0 +1,32 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"time"
+)
+
+// 时钟设备的计时方式(读取IO_CLOCK地址得到时钟的低16位)
+type ClockSource int
+
+const (
+	ClockNone  ClockSource = iota // 没有时钟设备(IO_CLOCK是普通内存)
+	ClockInstr                    // 按已执行的指令数目计时(结果可以重现)
+	ClockWall                     // 按真实时间计时(毫秒, 从第一次读取开始)
+)
+
+// 读取时钟
+func (p *Comet) clockTicks() uint16 {
+	switch p.Clock {
+	case ClockInstr:
+		return uint16(p.InstrCount)
+	case ClockWall:
+		if p.clockStart.IsZero() {
+			p.clockStart = time.Now()
+		}
+		return uint16(time.Since(p.clockStart) / time.Millisecond)
+	}
+	return p.Mem[IO_CLOCK]
+}
@@ -0,0 +1,56 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	// 读两次时钟, 中间是 5 次循环(每次 3 条指令)
+	const src = `MAIN START
+     LD   GR1,#FD12
+     LEA  GR3,0
+L    LEA  GR3,1,GR3
+     CPA  GR3,FIVE
+     JNZ  L
+     LD   GR2,#FD12
+     HALT
+FIVE DC   5
+     END`
+
+	p, _ := newTestComet(t, src)
+	p.Clock = ClockInstr
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GR[1] != 0 || p.GR[2] != 17 {
+		t.Fatalf("时钟 %d -> %d, 期望 0 -> 17", p.GR[1], p.GR[2])
+	}
+
+	// 没有时钟设备时是普通内存
+	p, _ = newTestComet(t, src)
+	p.Mem[IO_CLOCK] = 9
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GR[1] != 9 || p.GR[2] != 9 {
+		t.Fatalf("ClockNone: %d -> %d, 期望 9 -> 9", p.GR[1], p.GR[2])
+	}
+
+	p, _ = newTestComet(t, src)
+	p.Clock = ClockWall
+	if err := p.ExecAt(0); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if d := p.GR[2] - p.GR[1]; d < 20 {
+		t.Fatalf("ClockWall: %d -> %d, 期望至少增加 20 毫秒", p.GR[1], p.GR[2])
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// core文件的开头
+const CORE_MAGIC = "COMETCORE"
+
+// CPU状态的二进制大小(PC, FR, GR, Mem, 小端格式)
+const cpuBinarySize = 2 + 2 + 5*2 + MEM_SIZE*2
+
+// core文件的内容
+type Core struct {
+	CPU          // 异常停机时的CPU状态
+	Fault string // 异常停机的原因
+	Trace string // 跟踪缓存中最近执行的指令
+}
+
+// CPU状态编码为二进制(小端格式)
+func (p *CPU) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(cpuBinarySize)
+	if err := binary.Write(&buf, binary.LittleEndian, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 从二进制数据恢复CPU状态
+func (p *CPU) UnmarshalBinary(data []byte) error {
+	if len(data) != cpuBinarySize {
+		return fmt.Errorf("CPU数据大小错误: %d", len(data))
+	}
+	return binary.Read(bytes.NewReader(data), binary.LittleEndian, p)
+}
+
+// 输出core文件(CPU状态, 异常原因和跟踪缓存)
+func (p *Comet) WriteCore(w io.Writer) error {
+	cpu, err := p.CPU.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	var fault string
+	if p.err != nil {
+		fault = p.err.Error()
+	}
+
+	var bw = bufio.NewWriter(w)
+	bw.WriteString(CORE_MAGIC)
+	bw.Write(cpu)
+	for _, s := range []string{fault, p.TraceDump()} {
+		binary.Write(bw, binary.LittleEndian, uint32(len(s)))
+		bw.WriteString(s)
+	}
+	return bw.Flush()
+}
+
+// 读取core文件
+func ReadCore(r io.Reader) (*Core, error) {
+	var br = bufio.NewReader(r)
+
+	var magic = make([]byte, len(CORE_MAGIC))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != CORE_MAGIC {
+		return nil, errors.New("不是core文件")
+	}
+
+	var core = new(Core)
+	var cpu = make([]byte, cpuBinarySize)
+	if _, err := io.ReadFull(br, cpu); err != nil {
+		return nil, err
+	}
+	if err := core.CPU.UnmarshalBinary(cpu); err != nil {
+		return nil, err
+	}
+
+	for _, s := range []*string{&core.Fault, &core.Trace} {
+		var n uint32
+		if err := binary.Read(br, binary.LittleEndian, &n); err != nil {
+			return nil, err
+		}
+		var data = make([]byte, n)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, err
+		}
+		*s = string(data)
+	}
+
+	return core, nil
+}
+
+// 载入core文件
+func LoadCore(filename string) (*Core, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadCore(f)
+}
+
+// 异常停机时在CoreDir目录保存core文件(文件名包含时间)
+func (p *Comet) saveCore() {
+	var name = fmt.Sprintf("core-%s.dump", time.Now().Format("20060102-150405.000000"))
+	var path = filepath.Join(p.CoreDir, name)
+
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintln(p.Stdout, "保存core文件失败:", err)
+		return
+	}
+	if err = p.WriteCore(f); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		fmt.Fprintln(p.Stdout, "保存core文件失败:", err)
+		return
+	}
+
+	fmt.Fprintln(p.Stdout, "core文件保存到", path)
+}
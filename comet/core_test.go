@@ -0,0 +1,42 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCoreDump(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,7
+     DIV  GR1,Z
+     HALT
+Z    DC   0
+     END`)
+	p.CoreDir = t.TempDir()
+	p.TraceBuffer = 4
+	wantFault(t, p.Run(), FaultDivideByZero)
+
+	files, err := filepath.Glob(filepath.Join(p.CoreDir, "core-*.dump"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("core文件 %v, %v", files, err)
+	}
+	core, err := LoadCore(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if core.PC != 2 || core.GR[1] != 7 || core.Mem[5] != 0 || core.Mem[0] != p.Mem[0] {
+		t.Fatalf("CPU状态不同: PC = %x, GR1 = %d", core.PC, core.GR[1])
+	}
+	if core.Fault != p.Fault().Error() {
+		t.Fatalf("异常原因 %q, 期望 %q", core.Fault, p.Fault().Error())
+	}
+	if !strings.Contains(core.Trace, "mem[0002]: DIV") {
+		t.Fatalf("跟踪缓存中没有异常的指令:\n%s", core.Trace)
+	}
+}
@@ -0,0 +1,22 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 标记[start, end)区域为数据, 反汇编时按DC显示而不解码为指令
+func (p *Comet) MarkData(start, end uint16) {
+	if start < end {
+		p.data = append(p.data, [2]uint16{start, end})
+	}
+}
+
+// 地址是否在标记为数据的区域中
+func (p *Comet) IsData(adr uint16) bool {
+	for _, r := range p.data {
+		if adr >= r[0] && adr < r[1] {
+			return true
+		}
+	}
+	return false
+}
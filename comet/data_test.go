@@ -0,0 +1,46 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkData(t *testing.T) {
+	// 表中的字恰好可以解码为指令
+	p, _ := newTestComet(t, `MAIN START
+     LD   GR1,TAB
+     HALT
+TAB  DC   #1010
+     DC   #8100
+     DC   #0310
+     END`)
+
+	before := p.Listing()
+	if strings.Contains(before, "0003: 1010\t\tDC") {
+		t.Fatalf("没有标记时表被当作数据:\n%s", before)
+	}
+
+	p.MarkData(3, 6)
+	if !p.IsData(3) || !p.IsData(5) || p.IsData(2) || p.IsData(6) {
+		t.Fatal("IsData 的范围错误")
+	}
+
+	got := p.Listing()
+	for _, want := range []string{
+		"0000: 0110 0003\tLD GR1, 0003\n",
+		"0003: 1010\t\tDC\t4112\n",
+		"0004: 8100\t\tDC\t-32512\n",
+		"0005: 0310\t\tDC\t784\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("缺少 %q:\n%s", want, got)
+		}
+	}
+	if s := p.FormatInstruction(3, 3); strings.Count(s, ": DC ") != 3 {
+		t.Errorf("FormatInstruction 没有按数据显示:\n%s", s)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+)
+
+// 调试器的会话状态
+type debugSession struct {
+	asserts []*debugAssert // 断言
+	frames  *frameRecorder // 保存每一步的寄存器状态
+	track   int            // 跟踪读写的寄存器(-1表示不跟踪)
+	display int            // regs和dMem显示数据的进制(16, 10或2)
+}
+
+// 按进制格式化16位的数据, 十进制按有符号数显示
+func formatWord(v uint16, base int) string {
+	switch base {
+	case 2:
+		return fmt.Sprintf("%016b", v)
+	case 10:
+		return fmt.Sprintf("%d", int16(v))
+	default:
+		return fmt.Sprintf("%04x", v)
+	}
+}
+
+// 调试器执行一条指令: 跟踪寄存器, 保存帧, 检查监视点和断言
+// 监视点被修改或断言不成立时输出原因并返回false
+func (p *Comet) debugStep(s *debugSession) bool {
+	var pc = p.PC
+	var ins, ok = p.ParseInstruction(pc)
+	var old uint16
+	if s.track >= 0 {
+		old = p.GR[s.track]
+	}
+
+	if err := p.StepRun(); err != nil {
+		fmt.Fprintln(p.Stdout, err)
+	}
+
+	if s.track >= 0 && ok {
+		if r, w := ins.UsesGR(uint16(s.track)); r || w {
+			fmt.Fprintf(p.Stdout, "mem[%04x]: %-20v %s GR%d = %04x -> %04x\n",
+				pc, ins, readWriteName(r, w), s.track, old, p.GR[s.track])
+		}
+	}
+
+	if err := s.frames.capture(p, pc); err != nil {
+		fmt.Fprintln(p.Stdout, "保存帧失败:", err)
+	}
+
+	if hits := p.WatchHits(); len(hits) > 0 {
+		for _, h := range hits {
+			fmt.Fprintf(p.Stdout, "监视点 mem[%04x] 被 mem[%04x] 的指令修改: %04x -> %04x\n", h.Addr, h.PC, h.Old, h.New)
+		}
+		return false
+	}
+
+	if a := p.checkAsserts(s.asserts); a != nil {
+		x, _ := p.regValue(a.Reg)
+		fmt.Fprintf(p.Stdout, "断言失败：mem[%04x] 执行之后 %v 不成立 （%s = %04x）\n", pc, a, a.Reg, x)
+		return false
+	}
+	return true
+}
+
+func readWriteName(r, w bool) string {
+	switch {
+	case r && w:
+		return "读写"
+	case w:
+		return "写入"
+	default:
+		return "读取"
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatWord(t *testing.T) {
+	for _, tt := range []struct {
+		base int
+		want string
+	}{
+		{2, "1000000000000001"},
+		{10, "-32767"},
+		{16, "8001"},
+	} {
+		if s := formatWord(0x8001, tt.base); s != tt.want {
+			t.Errorf("formatWord(8001, %d) = %q, 期望 %q", tt.base, s, tt.want)
+		}
+	}
+}
+
+func TestDebugDisplay(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     HALT
+V    DC   #8001
+     END`)
+	out := runDebug(p, "setreg GR1 8001\ndisplay bin\nregs\nd 1 1\ndisplay dec\nregs\ndisplay oct\nq\n")
+	for _, want := range []string{
+		"regs 和 dMem 按 2 进制显示数据\n",
+		"GR[1] = 1000000000000001\tSP = ",
+		"mem[0001] = 1000000000000001\n",
+		"GR[1] = -32767\tSP = ",
+		"错误: 参数为 hex, dec 或 bin\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "更新testdata中的golden文件")
+
+// 计算 1+2+...+n, 程序之后是无法解码的字和缺少第二个字的双字长指令
+const disasmTestSrc = `MAIN START
+     LD   GR1,N
+     LEA  GR2,0
+L    ADD  GR2,N
+     SUB  GR1,ONE
+     ST   GR1,N
+     JNZ  L
+     POP  GR3
+     HALT
+N    DC   10
+ONE  DC   1
+     DC   #3000
+     DC   #0112
+     END`
+
+// 和testdata中的golden文件比较
+func checkGolden(t *testing.T, name, got string) {
+	t.Helper()
+	filename := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(filename, []byte(got), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(want) {
+		t.Fatalf("%s 不同:\n%s\n期望:\n%s", name, got, want)
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	prog, _, err := Assemble(disasmTestSrc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "disasm.golden", Disassemble(prog))
+	checkGolden(t, "disasm_range.golden", DisassembleRange(prog, 4, 10))
+
+	if s := DisassembleRange(prog, -1, 1000); s != Disassemble(prog) {
+		t.Fatalf("超出范围的区间没有截断:\n%s", s)
+	}
+	if s := Disassemble(nil); s != "" {
+		t.Fatalf("空程序的反汇编为 %q", s)
+	}
+}
+
+func TestDisassembleLabeled(t *testing.T) {
+	prog, _, err := Assemble(`MAIN START
+     LD   GR1,N
+     JZE  END1
+L    SUB  GR1,ONE
+     JNZ  L
+END1 HALT
+N    DC   3
+ONE  DC   1
+     END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `0000: 0110 0009	LD GR1, 0009
+0002: 1600 0008	JZE L0008
+L0004:
+0004: 0510 000a	SUB GR1, 000a
+0006: 1500 0004	JNZ L0004
+L0008:
+0008: 0000		HALT
+0009: 0003		HALT
+000a: 0001		HALT
+`
+	if s := DisassembleLabeled(prog); s != want {
+		t.Fatalf("DisassembleLabeled:\n%s\n期望:\n%s", s, want)
+	}
+
+	// 不使用标号时和Disassemble相同
+	raw := DisassembleWith(prog, DisasmOptions{})
+	if raw != Disassemble(prog) || strings.Contains(raw, "L000") {
+		t.Fatalf("没有标号的反汇编:\n%s", raw)
+	}
+}
+
+func TestDisassembleWithSymbols(t *testing.T) {
+	prog, _, err := Assemble(`MAIN START
+     LD   GR1,N
+L    CALL P
+     SUB  GR1,ONE
+     JNZ  L
+     JMP  DONE
+DONE HALT
+S    RET
+P    DC   S
+N    DC   3
+ONE  DC   1
+     END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// L和DONE没有外部标号, 使用合成的标号; ONE没有标号, 保留地址
+	var syms = SymbolTable{"count": 0x0d, "strlen": 0x0c, "func": 0x0b, "f": 0x0b}
+	const want = `0000: 0110 000d	LD GR1, count
+L0002:
+0002: 1900 000c	CALL strlen
+0004: 0510 000e	SUB GR1, 000e
+0006: 1500 0002	JNZ L0002
+0008: 1200 000a	JMP L000a
+L000a:
+000a: 0000		HALT
+f:
+000b: 1a00		RET
+strlen:
+000c: 000b		DC	11
+count:
+000d: 0003		HALT
+000e: 0001		HALT
+`
+	if s := DisassembleWith(prog, DisasmOptions{Labels: true, Symbols: syms}); s != want {
+		t.Fatalf("DisassembleWith:\n%s\n期望:\n%s", s, want)
+	}
+
+	// 不合成标号时没有外部标号的地址保持不变
+	s := DisassembleWith(prog, DisasmOptions{Symbols: syms})
+	for _, want := range []string{"\tCALL strlen\n", "\tJNZ 0002\n", "\tJMP 000a\n"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("缺少 %q:\n%s", want, s)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"errors"
+)
+
+var (
+	// 无法识别的指令
+	ErrIllegalInstruction = errors.New("非法指令")
+
+	// 指令中的GR或XR超出范围
+	ErrBadRegister = errors.New("非法寄存器")
+
+	// PC(或双字长指令的操作数)超出程序区(PC_MAX)
+	ErrPCOutOfRange = errors.New("PC超出范围")
+
+	// Run执行的指令超过MaxSteps(没有停机)
+	ErrStepLimitExceeded = errors.New("执行的指令超过限制")
+
+	// 输出超过OutputLimit
+	ErrOutputLimit = errors.New("输出超过限制")
+
+	// DIV或MOD的除数为0
+	ErrDivideByZero = errors.New("除数为0")
+
+	// 栈指针为0(或RequireSPInit时没有设置SP)时进栈(一般是忘记了初始化栈指针)
+	ErrStackUninitialized = errors.New("栈指针未初始化, 是否忘记设置GR4?")
+
+	// PUSH/CALL使SP低于StackFloor(一般是递归太深)
+	ErrStackOverflow = errors.New("栈溢出")
+
+	// POP/RET使SP高于栈顶的初始值(栈中已经没有数据)
+	ErrStackUnderflow = errors.New("栈下溢")
+)
@@ -0,0 +1,64 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 事件管道的缓存大小
+const EVENT_BUFFER_SIZE = 256
+
+// 执行事件类型
+type EventKind int
+
+const (
+	EventStep    EventKind = iota // 执行了一条指令
+	EventSyscall                  // 执行了系统调用
+	EventFault                    // 异常停机
+	EventHalt                     // 正常停机
+)
+
+// 执行事件
+type Event struct {
+	Kind      EventKind // 事件类型
+	PC        uint16    // 指令地址
+	Op        OpType    // 指令码
+	SyscallId uint8     // 系统调用号
+	Err       error     // 异常停机的原因
+}
+
+// 返回执行事件的管道
+//
+// 只有调用Events之后才会产生事件, 否则没有额外的开销.
+// 管道带有缓存, 缓存满了之后执行会阻塞直到事件被读取.
+// 停机之后发送最后的停机(或异常)事件, 然后关闭管道.
+func (p *Comet) Events() <-chan Event {
+	if p.events == nil {
+		p.events = make(chan Event, EVENT_BUFFER_SIZE)
+		if p.Shutdown {
+			close(p.events)
+			ch := p.events
+			p.events = nil
+			return ch
+		}
+	}
+	return p.events
+}
+
+// 发送单步执行产生的事件(lastErr为执行前的错误)
+func (p *Comet) sendEvents(pc uint16, op OpType, id uint8, lastErr error) {
+	if p.Shutdown && p.err != nil && p.err != lastErr {
+		p.events <- Event{Kind: EventFault, PC: pc, Op: op, Err: p.err}
+	} else if op == SYSCALL {
+		p.events <- Event{Kind: EventSyscall, PC: pc, Op: op, SyscallId: id}
+	} else {
+		p.events <- Event{Kind: EventStep, PC: pc, Op: op}
+	}
+
+	if p.Shutdown {
+		if p.err == nil || p.err == lastErr {
+			p.events <- Event{Kind: EventHalt, PC: pc, Op: op}
+		}
+		close(p.events)
+		p.events = nil
+	}
+}
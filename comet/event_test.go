@@ -0,0 +1,65 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"testing"
+)
+
+// 读取管道中的全部事件(管道关闭时返回)
+func collectEvents(ch <-chan Event) []Event {
+	var events []Event
+	for ev := range ch {
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestEvents(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR0,3
+     SYSCALL 2
+     HALT
+     END`)
+	ch := p.Events()
+
+	var done = make(chan []Event)
+	go func() { done <- collectEvents(ch) }()
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	events := <-done
+
+	var kinds []EventKind
+	for _, ev := range events {
+		kinds = append(kinds, ev.Kind)
+	}
+	var want = []EventKind{EventStep, EventSyscall, EventStep, EventHalt}
+	if len(kinds) != len(want) {
+		t.Fatalf("事件 %v, 期望 %v", kinds, want)
+	}
+	for i := range want {
+		if kinds[i] != want[i] {
+			t.Fatalf("事件 %v, 期望 %v", kinds, want)
+		}
+	}
+	if last := events[len(events)-1]; last.PC != 3 || last.Op != HALT {
+		t.Fatalf("最后的事件 %+v, 期望 HALT (mem[3])", last)
+	}
+}
+
+func TestEventsBadEntry(t *testing.T) {
+	p := NewComet([]uint16{uint16(HALT) << 8}, 10)
+	p.StrictEntry = true
+	ch := p.Events()
+
+	wantFault(t, p.Run(), FaultBadEntry)
+
+	// 入口检查失败时也发送异常事件并关闭管道
+	events := collectEvents(ch)
+	if len(events) != 1 || events[0].Kind != EventFault || events[0].Err == nil {
+		t.Fatalf("事件 %+v, 期望一个异常事件", events)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 异常停机的类型
+type FaultCode int
+
+const (
+	FaultUnknown            FaultCode = iota // 未知异常
+	FaultIllegalInstruction                  // 非法指令
+	FaultBadRegister                         // 非法寄存器
+	FaultDivideByZero                        // 除数为0
+	FaultOverflow                            // 算术溢出(OverflowFault)
+	FaultStackUninitialized                  // 栈指针未初始化
+	FaultStackRead                           // 读取已经出栈的数据(CheckStackLD)
+	FaultBadJump                             // 跳转到指令的操作数(CheckBoundary)
+	FaultZeroPage                            // 写入零页(ZeroPageProtect)
+	FaultBadEntry                            // 入口地址超出程序范围(StrictEntry)
+	FaultPCOutOfRange                        // PC超出程序区(PC_MAX)
+	FaultOutputLimit                         // 输出超过限制(OutputLimit)
+	FaultPostStep                            // PostStep返回的错误
+	FaultSyscall                             // 系统调用函数报告的错误(SyscallError)
+	FaultStackOverflow                       // 栈溢出(StackFloor)
+	FaultStackUnderflow                      // 栈下溢(SP超过栈顶的初始值)
+)
+
+var faultCodeNames = [...]string{
+	FaultUnknown:            "Unknown",
+	FaultIllegalInstruction: "IllegalInstruction",
+	FaultBadRegister:        "BadRegister",
+	FaultDivideByZero:       "DivideByZero",
+	FaultOverflow:           "Overflow",
+	FaultStackUninitialized: "StackUninitialized",
+	FaultStackRead:          "StackRead",
+	FaultBadJump:            "BadJump",
+	FaultZeroPage:           "ZeroPage",
+	FaultBadEntry:           "BadEntry",
+	FaultPCOutOfRange:       "PCOutOfRange",
+	FaultOutputLimit:        "OutputLimit",
+	FaultPostStep:           "PostStep",
+	FaultSyscall:            "Syscall",
+	FaultStackOverflow:      "StackOverflow",
+	FaultStackUnderflow:     "StackUnderflow",
+}
+
+func (c FaultCode) String() string {
+	if c < 0 || int(c) >= len(faultCodeNames) {
+		return fmt.Sprintf("FaultCode(%d)", int(c))
+	}
+	return faultCodeNames[c]
+}
+
+// 异常停机的信息
+//
+// 实现了error接口, StepRun和Run返回的错误就是*Fault.
+// 可以用errors.Is判断ErrIllegalInstruction等原因.
+type Fault struct {
+	PC     int       // 出错指令的地址
+	Op     int16     // 出错指令的指令码
+	Reason string    // 异常的描述
+	Code   FaultCode // 异常的类型
+
+	err error
+}
+
+func (p *Fault) Error() string {
+	return p.Reason
+}
+
+func (p *Fault) Unwrap() error {
+	return errors.Unwrap(p.err)
+}
+
+// 返回最后一次异常停机的信息, 没有异常(或正常停机)时返回nil
+func (p *Comet) Fault() *Fault {
+	var f *Fault
+	if errors.As(p.err, &f) {
+		return f
+	}
+	return nil
+}
+
+// 异常停机(出错指令为当前的PC)
+func (p *Comet) fault(code FaultCode, format string, a ...interface{}) {
+	p.faultAt(p.PC, code, format, a...)
+}
+
+// 异常停机, pc为出错指令的地址
+func (p *Comet) faultAt(pc uint16, code FaultCode, format string, a ...interface{}) {
+	err := fmt.Errorf(format, a...)
+	p.err = &Fault{
+		PC:     int(pc),
+		Op:     int16(p.Mem[pc] / 0x100),
+		Reason: err.Error(),
+		Code:   code,
+		err:    err,
+	}
+	p.Shutdown = true
+
+	if p.CoreDir != "" {
+		p.saveCore()
+	}
+}
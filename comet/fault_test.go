@@ -0,0 +1,117 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestStepRunError(t *testing.T) {
+	for _, tt := range []struct {
+		word   uint16
+		target error
+		reason string
+	}{
+		{0x3000, ErrIllegalInstruction, "非法指令：mem[1] = 3000"},
+		{uint16(LD)<<8 | 0x15, ErrBadRegister, "非法寄存器：mem[1] = 115"},
+	} {
+		var p = NewComet([]uint16{uint16(LEA)<<8 | 0x10, 1, 0}, 0)
+		p.Mem[1] = tt.word
+		p.PC = 1
+
+		err := p.StepRun()
+		if !errors.Is(err, tt.target) || err.Error() != tt.reason {
+			t.Fatalf("%04x: err = %v, 期望 %q", tt.word, err, tt.reason)
+		}
+		if !p.Shutdown || p.StepRun() != nil {
+			t.Fatalf("%04x: 异常之后没有停机", tt.word)
+		}
+
+		// Run返回同样的错误, 调试器输出错误
+		p = NewComet([]uint16{uint16(LEA)<<8 | 0x10, 1, 0}, 0)
+		p.Mem[2] = tt.word
+		if err := p.Run(); !errors.Is(err, tt.target) {
+			t.Fatalf("%04x: Run = %v, 期望 %v", tt.word, err, tt.target)
+		}
+		p = NewComet([]uint16{uint16(LEA)<<8 | 0x10, 1, 0}, 0)
+		p.Mem[2] = tt.word
+		if out := runDebug(p, "g\nq\n"); !strings.Contains(out, "：mem[2] = ") {
+			t.Fatalf("%04x: 调试器没有输出错误:\n%s", tt.word, out)
+		}
+	}
+}
+
+func TestFault(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     HALT
+     END`)
+	if err := p.Run(); err != nil || p.Fault() != nil {
+		t.Fatalf("正常停机: err = %v, Fault = %v", err, p.Fault())
+	}
+
+	p, _ = newTestComet(t, `MAIN START
+     LEA  GR1,1
+     DIV  GR1,Z
+     HALT
+Z    DC   0
+     END`)
+	err := p.Run()
+	f := p.Fault()
+	if f == nil || error(f) != err {
+		t.Fatalf("Fault = %v, 期望和Run的结果 %v 相同", f, err)
+	}
+	if f.PC != 2 || f.Op != int16(DIV) || f.Code != FaultDivideByZero || f.Reason != f.Error() {
+		t.Fatalf("Fault = %+v", f)
+	}
+	if f.Code.String() != "DivideByZero" || FaultCode(100).String() != "FaultCode(100)" {
+		t.Fatalf("FaultCode的名字错误: %v", f.Code)
+	}
+}
+
+func TestDivideByZero(t *testing.T) {
+	for _, op := range []string{"DIV", "MOD"} {
+		p, _ := newTestComet(t, `MAIN START
+     LEA  GR0,7
+     `+op+"  GR0,ZERO"+`
+     HALT
+ZERO DC   0
+     END`)
+		err := p.Run()
+		wantFault(t, err, FaultDivideByZero)
+		if !errors.Is(err, ErrDivideByZero) {
+			t.Fatalf("%s: err = %v, 期望 %v", op, err, ErrDivideByZero)
+		}
+		if p.PC != 2 || p.GR[0] != 7 {
+			t.Fatalf("%s: PC = %04x, GR0 = %d, 期望停在出错的指令", op, p.PC, p.GR[0])
+		}
+	}
+}
+
+func TestPCOutOfRange(t *testing.T) {
+	// 程序之后都是单字长的指令, 没有HALT时一直执行到PC_MAX
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,1
+     END`)
+	for adr := 2; adr < PC_MAX; adr++ {
+		p.Mem[adr] = uint16(CLR)<<8 | 0x20
+	}
+	err := p.Run()
+	wantFault(t, err, FaultPCOutOfRange)
+	if !errors.Is(err, ErrPCOutOfRange) || p.PC != PC_MAX || p.InstrCount != PC_MAX-1 {
+		t.Fatalf("err = %v, PC = %04x, 执行了 %d 条指令", err, p.PC, p.InstrCount)
+	}
+
+	// 双字长指令的操作数超出PC_MAX
+	p, _ = newTestComet(t, `MAIN START
+     JMP  #FBFF
+     END`)
+	p.Mem[PC_MAX-1] = uint16(LD) << 8
+	wantFault(t, p.Run(), FaultPCOutOfRange)
+	if p.PC != PC_MAX-1 {
+		t.Fatalf("PC = %04x, 期望停在 %04x", p.PC, PC_MAX-1)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+)
+
+// COMET-II标志寄存器的位(FlagBits时有效)
+const (
+	FLAG_ZF = 1 << 0 // 零标志: 结果为0
+	FLAG_SF = 1 << 1 // 符号标志: 结果为负
+	FLAG_OF = 1 << 2 // 溢出标志: 结果超出16位
+)
+
+// 按运算结果设置FR, of为是否溢出
+//
+// 没有设置FlagBits时FR保存运算结果本身(兼容以前的行为).
+func (p *Comet) setFR(v int16, of bool) {
+	if !p.FlagBits {
+		p.FR = v
+		return
+	}
+
+	var fr int16
+	if of {
+		fr |= FLAG_OF
+	}
+	if v < 0 {
+		fr |= FLAG_SF
+	}
+	if v == 0 {
+		fr |= FLAG_ZF
+	}
+	p.FR = fr
+}
+
+// 按比较结果设置FR, d为两个数之差(不会溢出), legacy为以前的FR值
+func (p *Comet) setCompareFR(d int32, legacy int16) {
+	if !p.FlagBits {
+		p.FR = legacy
+		return
+	}
+
+	switch {
+	case d < 0:
+		p.FR = FLAG_SF
+	case d == 0:
+		p.FR = FLAG_ZF
+	default:
+		p.FR = 0
+	}
+}
+
+// 符号标志(JMI, JPZ)
+func (p *Comet) flagSign() bool {
+	if p.FlagBits {
+		return p.FR&FLAG_SF != 0
+	}
+	return p.FR < 0
+}
+
+// 零标志(JZE, JNZ, CMOVZ)
+func (p *Comet) flagZero() bool {
+	if p.FlagBits {
+		return p.FR&FLAG_ZF != 0
+	}
+	return p.FR == 0
+}
+
+// 标志位的显示格式: OF SF ZF
+func (p *Comet) flagString() string {
+	var bit = func(mask int16) int {
+		if p.FR&mask != 0 {
+			return 1
+		}
+		return 0
+	}
+	return fmt.Sprintf("%d%d%d", bit(FLAG_OF), bit(FLAG_SF), bit(FLAG_ZF))
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFlagJumps(t *testing.T) {
+	// 每种标志状态下各条件跳转是否跳转
+	var states = []struct {
+		name   string
+		fr     int16 // FlagBits时的FR
+		legacy int16 // 以前的FR(运算结果)
+		jump   map[OpType]bool
+	}{
+		{"正数", 0, 5, map[OpType]bool{JPZ: true, JMI: false, JNZ: true, JZE: false}},
+		{"零", FLAG_ZF, 0, map[OpType]bool{JPZ: true, JMI: false, JNZ: false, JZE: true}},
+		{"负数", FLAG_SF, -5, map[OpType]bool{JPZ: false, JMI: true, JNZ: true, JZE: false}},
+		{"溢出", FLAG_OF | FLAG_SF, -5, map[OpType]bool{JPZ: false, JMI: true, JNZ: true, JZE: false}},
+	}
+
+	for _, st := range states {
+		for _, op := range []OpType{JPZ, JMI, JNZ, JZE} {
+			for _, flagBits := range []bool{false, true} {
+				p := NewComet([]uint16{uint16(op) << 8, 0x10}, 0)
+				p.FlagBits = flagBits
+				if p.FR = st.legacy; flagBits {
+					p.FR = st.fr
+				}
+				if err := p.ExecAt(0); err != nil {
+					t.Fatal(err)
+				}
+				if jumped := p.PC == 0x10; jumped != st.jump[op] {
+					t.Errorf("%s, %v (FlagBits = %v): 跳转 = %v", st.name, op, flagBits, jumped)
+				}
+			}
+		}
+	}
+}
+
+func TestFlagBits(t *testing.T) {
+	for _, tt := range []struct {
+		x    int16
+		flag string
+	}{
+		{3, "000"},
+		{5, "001"},
+		{7, "010"},
+	} {
+		p, _ := newTestComet(t, fmt.Sprintf(`MAIN START
+     LD   GR1,A
+     CPA  GR1,B
+     HALT
+A    DC   5
+B    DC   %d
+     END`, tt.x))
+		p.FlagBits = true
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if s := p.flagString(); s != tt.flag {
+			t.Fatalf("CPA 5, %d: FR = %s, 期望 %s", tt.x, s, tt.flag)
+		}
+		if out := runDebug(p, "r\nq\n"); !strings.Contains(out, "FR = "+tt.flag+" (OF SF ZF)") {
+			t.Fatalf("regs 没有显示标志位:\n%s", out)
+		}
+	}
+}
+
+func TestAddSubOverflow(t *testing.T) {
+	for _, tt := range []struct {
+		op   string
+		a, b int16
+		want uint16
+		flag string
+	}{
+		{"ADD", 0x7FFF, 1, 0x8000, "110"},
+		{"SUB", -0x8000, 1, 0x7FFF, "100"},
+		{"ADD", 0x7FFE, 1, 0x7FFF, "000"},
+		{"SUB", -0x7FFF, 1, 0x8000, "010"},
+		{"ADD", -1, 1, 0, "001"},
+	} {
+		p, _ := newTestComet(t, fmt.Sprintf(`MAIN START
+     LD   GR1,A
+     %s  GR1,B
+     HALT
+A    DC   %d
+B    DC   %d
+     END`, tt.op, tt.a, tt.b))
+		p.FlagBits = true
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if p.GR[1] != tt.want || p.flagString() != tt.flag {
+			t.Errorf("%d %s %d: GR1 = %04x, FR = %s, 期望 %04x, %s", tt.a, tt.op, tt.b, p.GR[1], p.flagString(), tt.want, tt.flag)
+		}
+	}
+}
+
+func TestLogicalArith(t *testing.T) {
+	// 同样的操作数, 算术运算按有符号数判断溢出, 逻辑运算按无符号数判断进位/借位
+	for _, tt := range []struct {
+		op   string
+		a, b uint16
+		want uint16
+		flag string
+	}{
+		{"ADD ", 0x7FFF, 1, 0x8000, "110"},
+		{"ADDL", 0x7FFF, 1, 0x8000, "010"},
+		{"ADD ", 0xFFFF, 1, 0, "001"},
+		{"ADDL", 0xFFFF, 1, 0, "101"},
+		{"SUB ", 0, 1, 0xFFFF, "010"},
+		{"SUBL", 0, 1, 0xFFFF, "110"},
+		{"SUB ", 0x8000, 1, 0x7FFF, "100"},
+		{"SUBL", 0x8000, 1, 0x7FFF, "000"},
+		{"CPA ", 0xFFFF, 1, 0xFFFF, "010"},
+		{"CPL ", 0xFFFF, 1, 0xFFFF, "000"},
+	} {
+		p, _ := newTestComet(t, fmt.Sprintf(`MAIN START
+     LD   GR1,A
+     %s GR1,B
+     HALT
+A    DC   #%04X
+B    DC   #%04X
+     END`, tt.op, tt.a, tt.b))
+		p.FlagBits = true
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if p.GR[1] != tt.want || p.flagString() != tt.flag {
+			t.Errorf("%04x %s %04x: GR1 = %04x, FR = %s, 期望 %04x, %s", tt.a, tt.op, tt.b, p.GR[1], p.flagString(), tt.want, tt.flag)
+		}
+	}
+
+	for _, op := range []OpType{ADDL, SUBL} {
+		if s := DisassembleWord(int16(op)<<8|0x10, 0x20); !strings.HasSuffix(s, "\t"+op.String()+" GR1, 0020") {
+			t.Errorf("反汇编为 %q", s)
+		}
+	}
+}
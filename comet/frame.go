@@ -0,0 +1,33 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// 默认最多保存的帧数
+const FRAME_LIMIT = 1000
+
+// 记录每一步执行之后的寄存器状态(每帧一个文本文件), 用于制作教学动画
+type frameRecorder struct {
+	dir   string // 保存的目录
+	limit int    // 最多保存的帧数
+	n     int    // 已经保存的帧数
+}
+
+// 保存一帧: frame-00001.txt, 包含指令地址和寄存器状态
+func (r *frameRecorder) capture(p *Comet, pc uint16) error {
+	if r == nil || r.n >= r.limit {
+		return nil
+	}
+	r.n++
+
+	var name = filepath.Join(r.dir, fmt.Sprintf("frame-%05d.txt", r.n))
+	var text = fmt.Sprintf("第 %d 步\n%s%v\n", r.n, p.FormatInstruction(pc, 1), p)
+	return ioutil.WriteFile(name, []byte(text), 0666)
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugFrames(t *testing.T) {
+	const src = `MAIN START
+     LEA  GR1,1
+     LEA  GR1,2
+     LEA  GR1,3
+     HALT
+     END`
+
+	for _, tt := range []struct {
+		args string
+		want int
+	}{
+		{"", 3},
+		{" 2", 2},
+	} {
+		p, _ := newTestComet(t, src)
+		dir := t.TempDir()
+		out := runDebug(p, "frames "+dir+tt.args+"\ns 3\nframes off\nq\n")
+
+		files, err := filepath.Glob(filepath.Join(dir, "frame-*.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != tt.want {
+			t.Fatalf("frames%s: 保存了 %d 帧, 期望 %d:\n%s", tt.args, len(files), tt.want, out)
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, "frame-00002.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), "第 2 步\nmem[0002]: LEA GR1, 0002\n") {
+			t.Fatalf("第2帧的内容错误:\n%s", data)
+		}
+	}
+}
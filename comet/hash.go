@@ -0,0 +1,25 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// FNV-1a 64位参数
+const (
+	fnvOffset64 = 14695981039346656037
+	fnvPrime64  = 1099511628211
+)
+
+// 计算内存区间[start, end)的哈希值(FNV-1a)
+//
+// 界面可以对每个显示区域计算哈希, 只重绘哈希变化的区域.
+// 只遍历一次区间, 不分配内存; end <= start 时返回空区间的哈希值.
+func (p *Comet) RangeHash(start, end uint16) uint64 {
+	var h uint64 = fnvOffset64
+	for i := int(start); i < int(end); i++ {
+		v := p.Mem[i]
+		h = (h ^ uint64(v>>8)) * fnvPrime64
+		h = (h ^ uint64(v&0xFF)) * fnvPrime64
+	}
+	return h
+}
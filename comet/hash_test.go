@@ -0,0 +1,33 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"testing"
+)
+
+func TestRangeHash(t *testing.T) {
+	p := NewComet(nil, 0)
+	h := p.RangeHash(0x100, 0x110)
+
+	// 区间之外的修改不影响哈希值
+	p.Mem[0xFF] = 1
+	p.Mem[0x110] = 1
+	if got := p.RangeHash(0x100, 0x110); got != h {
+		t.Fatalf("区间之外的修改改变了哈希值: %x -> %x", h, got)
+	}
+
+	// 区间之内的修改改变哈希值, 恢复之后哈希值也恢复
+	for _, adr := range []uint16{0x100, 0x108, 0x10F} {
+		p.Mem[adr] = 0x0100
+		if got := p.RangeHash(0x100, 0x110); got == h {
+			t.Fatalf("修改 mem[%x] 没有改变哈希值", adr)
+		}
+		p.Mem[adr] = 0
+		if got := p.RangeHash(0x100, 0x110); got != h {
+			t.Fatalf("恢复 mem[%x] 之后哈希值不同", adr)
+		}
+	}
+}
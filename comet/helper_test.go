@@ -0,0 +1,58 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 汇编src并创建虚拟机, 没有输入, 输出写入返回的Buffer
+func newTestComet(t testing.TB, src string) (*Comet, *bytes.Buffer) {
+	t.Helper()
+	p := NewComet(assembleTest(t, src))
+	var out bytes.Buffer
+	p.Stdin = bufio.NewReader(strings.NewReader(""))
+	p.Stdout = &out
+	return p, &out
+}
+
+// 汇编src, 返回程序和入口地址
+func assembleTest(t testing.TB, src string) ([]uint16, int) {
+	t.Helper()
+	prog, entry, err := Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var code = make([]uint16, len(prog))
+	for i, v := range prog {
+		code[i] = uint16(v)
+	}
+	return code, entry
+}
+
+// 执行调试器命令(每行一个), 返回调试器的输出
+func runDebug(p *Comet, cmds string) string {
+	var out bytes.Buffer
+	p.Stdin = bufio.NewReader(strings.NewReader(cmds))
+	p.Stdout = &out
+	p.DebugRun()
+	return out.String()
+}
+
+// 检查err是指定类型的异常停机
+func wantFault(t testing.TB, err error, code FaultCode) {
+	t.Helper()
+	var f *Fault
+	if !errors.As(err, &f) {
+		t.Fatalf("err = %v, 期望异常停机 %v", err, code)
+	}
+	if f.Code != code {
+		t.Fatalf("异常停机 %v, 期望 %v: %v", f.Code, code, err)
+	}
+}
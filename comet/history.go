@@ -0,0 +1,211 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+)
+
+// 调试器默认保留的历史步数(反向单步)
+const HISTORY_SIZE = 1024
+
+// 一步执行之前的状态和修改的内存
+type historyRecord struct {
+	pc       uint16
+	fr       int16
+	gr       [5]uint16
+	shutdown bool
+	err      error
+	overflow bool
+	spInit   bool
+	spTop    uint16
+	depth    int
+	count    int64
+	cycles   int64
+	exitCode int
+	outBytes int
+	sysLog   int
+
+	mem    []memDelta // 修改的内存(按写入顺序)
+	input  []byte     // 读取的输入(回退时重新排队)
+	output []byte     // 输出的内容(回退时从Stdout中删除)
+	io     bool       // 读写了设备(MMIO)或执行了用户的系统调用, 不能回退
+}
+
+type memDelta struct {
+	adr uint16
+	old uint16
+}
+
+// 记录执行之前的状态(由StepRun调用)
+func (p *Comet) historyBegin() {
+	if len(p.history) != p.HistorySize {
+		p.history = make([]historyRecord, p.HistorySize)
+		p.histNext, p.histLen = 0, 0
+	}
+
+	var op, id = OpType(p.Mem[p.PC] / 0x100), p.Mem[p.PC] % 0x100
+	var rec = &p.history[p.histNext]
+	*rec = historyRecord{
+		pc:       p.PC,
+		fr:       p.FR,
+		gr:       p.GR,
+		shutdown: p.Shutdown,
+		err:      p.err,
+		overflow: p.Overflow,
+		spInit:   p.spInitialized,
+		spTop:    p.spTop,
+		depth:    p.callDepth,
+		count:    p.InstrCount,
+		cycles:   p.Cycles,
+		exitCode: p.ExitCode,
+		outBytes: p.outputBytes,
+		sysLog:   len(p.syscallLog),
+		mem:      rec.mem[:0],
+		input:    rec.input[:0],
+		output:   rec.output[:0],
+		io:       op == SYSCALL && id >= SYSCALL_USER_START,
+	}
+	p.histCur = rec
+}
+
+// 完成一步的记录
+func (p *Comet) historyEnd() {
+	p.histCur = nil
+	p.histNext = (p.histNext + 1) % len(p.history)
+	if p.histLen < len(p.history) {
+		p.histLen++
+	}
+}
+
+// 反向单步: 恢复到上一条指令执行之前的状态
+//
+// 需要设置HistorySize(调试器默认为HISTORY_SIZE).
+// 内置的系统调用和IO外设可以回退: 读取的输入重新排队(QueueInput), 下次执行时读到同样的数据;
+// 输出的内容在Stdout末尾时(比如bytes.Buffer)删除, 已经显示的输出(比如终端)保留.
+// 读写过MMIO设备或执行了用户系统调用(SYSCALL_USER_START之后)的指令不能回退, 返回错误.
+func (p *Comet) StepBack() error {
+	_, err := p.stepBack()
+	return err
+}
+
+// 反向单步, 返回不能删除(保留在Stdout中)的输出
+func (p *Comet) stepBack() (kept []byte, err error) {
+	if p.histLen == 0 {
+		return nil, fmt.Errorf("没有可以回退的指令")
+	}
+
+	var i = (p.histNext - 1 + len(p.history)) % len(p.history)
+	var rec = &p.history[i]
+	if rec.io {
+		return nil, fmt.Errorf("mem[%04x] 的指令读写了设备或执行了用户的系统调用, 不能回退", rec.pc)
+	}
+
+	if len(rec.input) > 0 {
+		var rest = append(append([]byte(nil), rec.input...), p.input.Bytes()...)
+		p.input.Reset()
+		p.input.Write(rest)
+	}
+	if len(rec.output) > 0 && !p.undoOutput(rec.output) {
+		kept = append(kept, rec.output...)
+	}
+
+	for k := len(rec.mem) - 1; k >= 0; k-- {
+		var adr = rec.mem[k].adr
+		p.Mem[adr] = rec.mem[k].old
+		if _, ok := p.watches[adr]; ok {
+			p.watches[adr] = rec.mem[k].old
+		}
+	}
+	p.PC, p.FR, p.GR = rec.pc, rec.fr, rec.gr
+	p.Shutdown, p.err = rec.shutdown, rec.err
+	p.Overflow, p.spInitialized, p.spTop = rec.overflow, rec.spInit, rec.spTop
+	p.callDepth = rec.depth
+	p.InstrCount, p.Cycles = rec.count, rec.cycles
+	p.ExitCode, p.outputBytes = rec.exitCode, rec.outBytes
+	p.syscallLog = p.syscallLog[:rec.sysLog]
+
+	p.histNext = i
+	p.histLen--
+	return kept, nil
+}
+
+// 从Stdout的末尾删除输出的内容(Stdout需要有Bytes和Truncate方法), 成功时返回true
+func (p *Comet) undoOutput(out []byte) bool {
+	w, ok := p.Stdout.(interface {
+		Bytes() []byte
+		Truncate(n int)
+	})
+	if !ok || !bytes.HasSuffix(w.Bytes(), out) {
+		return false
+	}
+	w.Truncate(len(w.Bytes()) - len(out))
+	return true
+}
+
+// 输入指令读取数据的接口(bufio.Reader和bytes.Buffer都满足)
+type inputReader interface {
+	io.Reader
+	io.RuneScanner
+	io.ByteReader
+}
+
+// 记录读取的输入, 用于反向单步时重新排队
+type inputRecorder struct {
+	r    inputReader
+	rec  *historyRecord
+	last int // 最近一次ReadRune记录的字节数(UnreadRune时删除)
+}
+
+func (r *inputRecorder) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.rec.input = append(r.rec.input, b[:n]...)
+	r.last = 0
+	return n, err
+}
+
+func (r *inputRecorder) ReadByte() (byte, error) {
+	c, err := r.r.ReadByte()
+	if err == nil {
+		r.rec.input = append(r.rec.input, c)
+	}
+	r.last = 0
+	return c, err
+}
+
+func (r *inputRecorder) ReadRune() (rune, int, error) {
+	c, size, err := r.r.ReadRune()
+	r.last = 0
+	if err == nil {
+		var buf [utf8.UTFMax]byte
+		r.last = utf8.EncodeRune(buf[:], c)
+		r.rec.input = append(r.rec.input, buf[:r.last]...)
+	}
+	return c, size, err
+}
+
+func (r *inputRecorder) UnreadRune() error {
+	if err := r.r.UnreadRune(); err != nil {
+		return err
+	}
+	r.rec.input = r.rec.input[:len(r.rec.input)-r.last]
+	r.last = 0
+	return nil
+}
+
+// 记录输出的内容, 用于反向单步时删除
+type outputRecorder struct {
+	w   io.Writer
+	rec *historyRecord
+}
+
+func (w outputRecorder) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.rec.output = append(w.rec.output, b[:n]...)
+	return n, err
+}
@@ -0,0 +1,125 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStepBackSyscall(t *testing.T) {
+	p := NewComet([]uint16{
+		uint16(SYSCALL)<<8 | SYSCALL_READ,
+		uint16(SYSCALL)<<8 | SYSCALL_WRITE,
+		uint16(SYSCALL)<<8 | SYSCALL_READ,
+		uint16(HALT) << 8,
+	}, 0)
+	var out bytes.Buffer
+	p.Stdin = bufio.NewReader(strings.NewReader("42\n7\n"))
+	p.Stdout = &out
+	p.Syscall = Syscall
+	p.HistorySize = 8
+
+	p.StepRun()
+	p.StepRun()
+	if out.String() != "42\n" {
+		t.Fatalf("输出 %q, 期望 \"42\\n\"", out.String())
+	}
+
+	// 回退输出和输入
+	for i := 0; i < 2; i++ {
+		if err := p.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.PC != 0 || p.GR[0] != 0 || out.Len() != 0 {
+		t.Fatalf("回退之后 PC = %x, GR0 = %d, 输出 %q", p.PC, p.GR[0], out.String())
+	}
+
+	// 重新执行时读到同样的输入
+	p.Run()
+	if p.err != nil {
+		t.Fatal(p.err)
+	}
+	if out.String() != "42\n" || p.GR[0] != 7 {
+		t.Fatalf("重新执行: 输出 %q, GR0 = %d, 期望 \"42\\n\", 7", out.String(), p.GR[0])
+	}
+}
+
+func TestStepBackUserSyscall(t *testing.T) {
+	p := NewComet([]uint16{
+		uint16(SYSCALL)<<8 | SYSCALL_USER_START,
+		uint16(HALT) << 8,
+	}, 0)
+	p.Syscall = Syscall
+	p.HistorySize = 8
+
+	p.StepRun()
+	if err := p.StepBack(); err == nil || !strings.Contains(err.Error(), "不能回退") {
+		t.Fatalf("err = %v, 期望不能回退", err)
+	}
+}
+
+func TestDebugBackOut(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR0,S
+     LEA  GR1,2
+     SYSCALL 4
+     HALT
+S    DC   'OK'
+     END`)
+	out := runDebug(p, "s 3\nback\nq\n")
+
+	// 调试器的输出在程序的输出之后, 已经显示的输出不能撤销
+	for _, want := range []string{`注意: mem[0004] 的输出 "OK" 已经显示, 不能撤销`, "回退 1 条指令 (PC = 0004)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestStepBackWatch(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,5
+     ST   GR1,X
+     PUSH 0,GR1
+     HALT
+X    DC   0
+     END`)
+	p.HistorySize = 8
+	p.SetWatch(0x07)
+
+	// 回退之后重新执行ST, 监视点要再次触发
+	for i := 0; i < 2; i++ {
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if hits := p.WatchHits(); len(hits) != 1 || hits[0].Old != 0 || hits[0].New != 5 {
+			t.Fatalf("第 %d 次: WatchHits = %+v", i+1, hits)
+		}
+		if i == 0 {
+			if err := p.StepBack(); err != nil {
+				t.Fatal(err)
+			}
+			if p.PC != 2 || p.Mem[7] != 0 {
+				t.Fatalf("回退之后 PC = %04x, X = %d", p.PC, p.Mem[7])
+			}
+		}
+	}
+
+	// 回退PUSH恢复SP, FR和栈中的数据
+	var fr = p.FR
+	if err := p.StepRun(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.StepBack(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GR[4] != SP_START || p.FR != fr || p.Mem[SP_START-1] != 0 || len(p.WatchHits()) != 0 {
+		t.Fatalf("回退PUSH之后 SP = %04x, FR = %04x, mem[%04x] = %04x", p.GR[4], uint16(p.FR), SP_START-1, p.Mem[SP_START-1])
+	}
+}
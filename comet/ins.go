@@ -22,12 +22,17 @@ type Instruction struct {
 
 // 解码指令
 func (p *CPU) ParseInstruction(pc uint16) (ins *Instruction, ok bool) {
+	return decodeInstruction(p.Mem[pc], p.Mem[pc+1])
+}
+
+// 解码指令, w是指令的第一个字, next是后面的字(双字长指令的地址)
+func decodeInstruction(w, next uint16) (ins *Instruction, ok bool) {
 	ins = &Instruction{
-		Op:        OpType(p.Mem[pc] / 0x100),
-		GR:        p.Mem[pc] % 0x100 / 0x10,
-		XR:        p.Mem[pc] % 0x10,
-		ADR:       uint16(p.Mem[pc+1]),
-		SyscallId: uint8(p.Mem[pc] % 0x100),
+		Op:        OpType(w / 0x100),
+		GR:        w % 0x100 / 0x10,
+		XR:        w % 0x10,
+		ADR:       next,
+		SyscallId: uint8(w % 0x100),
 	}
 
 	if !ins.Valid() {
@@ -38,12 +43,212 @@ func (p *CPU) ParseInstruction(pc uint16) (ins *Instruction, ok bool) {
 	return ins, true
 }
 
+// 反汇编一条指令(不需要程序和虚拟机), next是后面的字
+//
+// 格式和程序列表相同: 双字长指令同时显示两个字(表示用到了next),
+// 单字长指令只显示一个字, 无法解码时按数据(DC)显示.
+func DisassembleWord(word, next int16) string {
+	ins, ok := decodeInstruction(uint16(word), uint16(next))
+	switch {
+	case !ok:
+		return fmt.Sprintf("%04x\t\tDC\t%d", uint16(word), word)
+	case ins.Op.Size() == 2:
+		return fmt.Sprintf("%04x %04x\t%v", uint16(word), uint16(next), ins)
+	default:
+		return fmt.Sprintf("%04x\t\t%v", uint16(word), ins)
+	}
+}
+
+// 反汇编整个程序(不需要虚拟机), 格式和程序列表相同
+func Disassemble(prog []int16) string {
+	return DisassembleRange(prog, 0, len(prog))
+}
+
+// 反汇编程序中[start, end)区间的指令, 地址为程序中的下标
+//
+// 无法解码的字, 以及第二个字超出程序的双字长指令按数据(DC)显示.
+func DisassembleRange(prog []int16, start, end int) string {
+	var buf bytes.Buffer
+	for _, x := range disasmWalk(prog, start, end) {
+		fmt.Fprintf(&buf, "%04x: %s\n", x.pc, x.text)
+	}
+	return buf.String()
+}
+
+// 反汇编整个程序, 跳转和调用的目标用合成的标号(比如L0003)表示
+//
+// 先找出全部跳转(JMP, JPZ, JMI, JNZ, JZE)和CALL指令的目标, 在目标指令之前输出标号行,
+// 指令中的地址也换成标号. 带变址寄存器的目标不确定, 目标不是指令开始的位置时也不生成标号.
+// 需要原始的输出(没有标号)时使用Disassemble.
+func DisassembleLabeled(prog []int16) string {
+	return DisassembleWith(prog, DisasmOptions{Labels: true})
+}
+
+// 反汇编的选项
+type DisasmOptions struct {
+	Labels  bool        // 跳转和调用的目标用合成的标号表示(见DisassembleLabeled)
+	Symbols SymbolTable // 外部的标号表, 优先于合成的标号
+}
+
+// 按选项反汇编整个程序
+//
+// Symbols中的标号在对应的指令或数据之前输出标号行, 指令中的地址(包括数据的地址)也换成标号;
+// 同一个地址有多个标号时使用按字母顺序的第一个. 没有外部标号的跳转目标按Labels选项处理.
+func DisassembleWith(prog []int16, opts DisasmOptions) string {
+	var names = make(map[int]string)
+	for name, adr := range opts.Symbols {
+		if old, ok := names[int(adr)]; !ok || name < old {
+			names[int(adr)] = name
+		}
+	}
+
+	var list = disasmWalk(prog, 0, len(prog))
+	var starts = make(map[int]bool)
+	for _, x := range list {
+		starts[x.pc] = true
+	}
+	var labels = make(map[int]bool)
+	for _, x := range list {
+		if adr, ok := x.target(); ok && starts[adr] && opts.Labels {
+			labels[adr] = true
+		}
+	}
+	var name = func(adr int) (string, bool) {
+		if s, ok := names[adr]; ok {
+			return s, true
+		}
+		if labels[adr] {
+			return fmt.Sprintf("L%04x", adr), true
+		}
+		return "", false
+	}
+
+	var buf bytes.Buffer
+	for _, x := range list {
+		if s, ok := name(x.pc); ok {
+			fmt.Fprintf(&buf, "%s:\n", s)
+		}
+		if x.ins != nil && x.ins.Op.Size() == 2 && x.ins.Op != SYSCALL {
+			if _, isTarget := x.target(); isTarget || names[int(x.ins.ADR)] != "" {
+				if s, ok := name(int(x.ins.ADR)); ok {
+					fmt.Fprintf(&buf, "%04x: %04x %04x\t%s\n", x.pc, x.word, x.ins.ADR, x.ins.withAddr(s))
+					continue
+				}
+			}
+		}
+		fmt.Fprintf(&buf, "%04x: %s\n", x.pc, x.text)
+	}
+	return buf.String()
+}
+
+// 双字长指令的格式, 地址用adr表示
+func (p *Instruction) withAddr(adr string) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%v ", p.Op)
+	if p.Op.UseGR() {
+		fmt.Fprintf(&buf, "GR%d, ", p.GR)
+	}
+	buf.WriteString(adr)
+	if p.XR != 0 {
+		fmt.Fprintf(&buf, ", GR%d", p.XR)
+	}
+	return buf.String()
+}
+
+// 反汇编的一行
+type disasmLine struct {
+	pc   int
+	word uint16       // 指令的第一个字
+	ins  *Instruction // 无法解码时为nil
+	text string       // 机器码和指令(和DisassembleWord相同)
+}
+
+// 跳转和调用指令的目标地址(没有变址寄存器时)
+func (x *disasmLine) target() (int, bool) {
+	if x.ins == nil || x.ins.XR != 0 {
+		return 0, false
+	}
+	switch x.ins.Op {
+	case JMP, JPZ, JMI, JNZ, JZE, CALL:
+		return int(x.ins.ADR), true
+	}
+	return 0, false
+}
+
+// 按指令长度遍历程序中[start, end)区间
+func disasmWalk(prog []int16, start, end int) []disasmLine {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(prog) {
+		end = len(prog)
+	}
+
+	var list []disasmLine
+	for pc := start; pc < end; {
+		var word, next = prog[pc], int16(0)
+		if pc+1 < len(prog) {
+			next = prog[pc+1]
+		}
+
+		ins, ok := decodeInstruction(uint16(word), uint16(next))
+		if ok && ins.Op.Size() == 2 && pc+1 >= len(prog) {
+			list = append(list, disasmLine{pc: pc, word: uint16(word), text: fmt.Sprintf("%04x\t\tDC\t%d", uint16(word), word)})
+			pc++
+			continue
+		}
+
+		list = append(list, disasmLine{pc: pc, word: uint16(word), ins: ins, text: DisassembleWord(word, next)})
+		if ok {
+			pc += int(ins.Op.Size())
+		} else {
+			pc++
+		}
+	}
+	return list
+}
+
+// 指令的字长(1或2), word是指令的第一个字, 无效指令返回0
+func InstrLen(word int16) int {
+	ins, ok := decodeInstruction(uint16(word), 0)
+	if !ok {
+		return 0
+	}
+	return int(ins.Op.Size())
+}
+
+// 指令是否读取或写入寄存器r(包括XR和栈指令隐含使用的GR4)
+// 系统调用视为读写GR0 ~ GR3
+func (p *Instruction) UsesGR(r uint16) (read, write bool) {
+	switch p.Op {
+	case SYSCALL:
+		return r < 4, r < 4
+	case PUSH, POP, CALL, RET:
+		read, write = r == 4, r == 4
+	}
+
+	if p.Op.UseGR() && p.GR == r {
+		switch p.Op {
+		case LD, LEA, POP, LDB, LDBS, CLR, CMOVZ:
+			write = true
+		case ST, STB, CPA, CPL, TEST:
+			read = true
+		default:
+			read, write = true, true
+		}
+	}
+	if p.Op.Size() == 2 && p.XR != 0 && p.XR == r {
+		read = true
+	}
+	return
+}
+
 // 有效的指令
 func (p *Instruction) Valid() bool {
 	if !p.Op.Valid() {
 		return false
 	}
-	if p.GR > 4 || p.XR > 4 {
+	if p.Op != SYSCALL && (p.GR > 4 || p.XR > 4) {
 		return false
 	}
 	return true
@@ -80,10 +285,10 @@ func (p *Instruction) String() string {
 		if p.Op.Size() == 2 {
 			if p.XR != 0 {
 				// OpName GR0, ADR, GR1
-				fmt.Fprintf(&buf, ", %04x, GR%d", p.ADR, p.XR)
+				fmt.Fprintf(&buf, "%v GR%d, %04x, GR%d", p.Op, p.GR, p.ADR, p.XR)
 			} else {
 				// OpName GR0, ADR
-				fmt.Fprintf(&buf, "%v GR%d", p.Op, p.GR)
+				fmt.Fprintf(&buf, "%v GR%d, %04x", p.Op, p.GR, p.ADR)
 			}
 		} else {
 			// OpName GR0
@@ -91,8 +296,13 @@ func (p *Instruction) String() string {
 		}
 	} else {
 		if p.Op.Size() == 2 {
-			// OpName ADR
-			fmt.Fprintf(&buf, "%v, %04x", p.Op, p.ADR)
+			if p.XR != 0 {
+				// OpName ADR, GR1
+				fmt.Fprintf(&buf, "%v %04x, GR%d", p.Op, p.ADR, p.XR)
+			} else {
+				// OpName ADR
+				fmt.Fprintf(&buf, "%v %04x", p.Op, p.ADR)
+			}
 		} else {
 			// OpName
 			fmt.Fprintf(&buf, "%v", p.Op)
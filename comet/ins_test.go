@@ -0,0 +1,50 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"testing"
+)
+
+func TestInstrLen(t *testing.T) {
+	for _, tt := range []struct {
+		word uint16
+		n    int
+	}{
+		{uint16(HALT) << 8, 1},
+		{uint16(POP)<<8 | 0x10, 1},
+		{uint16(RET) << 8, 1},
+		{uint16(CLR)<<8 | 0x20, 1},
+		{uint16(SYSCALL)<<8 | 0x02, 1},
+		{uint16(LD)<<8 | 0x12, 2},
+		{uint16(ST) << 8, 2},
+		{uint16(JMP) << 8, 2},
+		{uint16(PUSH) << 8, 2},
+		{uint16(CALL) << 8, 2},
+		{uint16(LDB)<<8 | 0x10, 2},
+		{0x3000, 0},               // 没有定义的指令码
+		{uint16(LD)<<8 | 0x15, 0}, // 没有GR5
+	} {
+		if n := InstrLen(int16(tt.word)); n != tt.n {
+			t.Errorf("%04x: InstrLen = %d, 期望 %d", tt.word, n, tt.n)
+		}
+	}
+}
+
+func TestDisassembleWord(t *testing.T) {
+	for _, tt := range []struct {
+		word, next int16
+		want       string
+	}{
+		{int16(LD)<<8 | 0x12, 0x0010, "0112 0010\tLD GR1, 0010, GR2"},
+		{int16(POP)<<8 | 0x30, 0x0010, "1830\t\tPOP GR3"},
+		{int16(HALT) << 8, -1, "0000\t\tHALT"},
+		{0x3000, 0x0010, "3000\t\tDC\t12288"},
+	} {
+		if s := DisassembleWord(tt.word, tt.next); s != tt.want {
+			t.Errorf("%04x %04x: %q, 期望 %q", uint16(tt.word), uint16(tt.next), s, tt.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ package comet
 const (
 	IO_ADDR  = 0xFD10 // 数据地址
 	IO_FLAG  = 0xFD11 // 标志位
+	IO_CLOCK = 0xFD12 // 时钟(只读, 见Comet.Clock)
 	IO_FIO   = 0x0100 // 输入输出
 	IO_TYPE  = 0x1C00 // 传输类型
 	IO_MAX   = 0x00FF // 最大数目
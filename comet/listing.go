@@ -0,0 +1,65 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// 格式化程序的完整列表(地址, 机器码, 指令)
+//
+// 范围是载入的程序(从0地址到程序结束), 无法解码的字和MarkData标记的区域按数据显示.
+func (p *Comet) Listing() string {
+	var buf bytes.Buffer
+
+	for pc := 0; pc < p.progSize; {
+		ins, ok := p.ParseInstruction(uint16(pc))
+		if !ok || p.IsData(uint16(pc)) {
+			fmt.Fprintf(&buf, "%04x: %04x\t\tDC\t%d%s\n", pc, p.Mem[pc], int16(p.Mem[pc]), p.noteSuffix(uint16(pc)))
+			pc++
+			continue
+		}
+
+		if ins.Op.Size() == 2 {
+			fmt.Fprintf(&buf, "%04x: %04x %04x\t%v%s\n", pc, p.Mem[pc], p.Mem[pc+1], ins, p.noteSuffix(uint16(pc)))
+		} else {
+			fmt.Fprintf(&buf, "%04x: %04x\t\t%v%s\n", pc, p.Mem[pc], ins, p.noteSuffix(uint16(pc)))
+		}
+		pc += int(ins.Op.Size())
+	}
+
+	return buf.String()
+}
+
+// 输出带文件头(入口地址, 程序大小, 生成时间)的程序列表
+func (p *Comet) WriteListing(w io.Writer) error {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "; 入口地址: %04x\n", p.entry)
+	fmt.Fprintf(&buf, "; 程序大小: %d\n", p.progSize)
+	fmt.Fprintf(&buf, "; 生成时间: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintln(&buf)
+	buf.WriteString(p.Listing())
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// 程序列表保存到文件
+func (p *Comet) SaveListing(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = p.WriteListing(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,36 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSaveListing(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START ENTRY
+DATA DC   5
+ENTRY LD  GR1,DATA
+     HALT
+     END`)
+	filename := filepath.Join(t.TempDir(), "a.lst")
+
+	out := runDebug(p, "savelst "+filename+"\nq\n")
+	if !strings.Contains(out, "程序列表保存到 "+filename) {
+		t.Fatalf("没有保存程序列表:\n%s", out)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"; 入口地址: 0001\n", "; 程序大小: 4\n", "; 生成时间: ", "0001: 0110 0000\tLD GR1, 0000"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("缺少 %q:\n%s", want, data)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 两个内存区域中不同的位置
+type MemDiff struct {
+	Offset int    // 相对于区域开始的偏移
+	A      uint16 // 第一个区域的值
+	B      uint16 // 第二个区域的值
+}
+
+// 比较从a1和a2开始的n个字, 返回全部不同的位置
+//
+// 只读取内存, 两个区域可以重叠; 超出内存的部分不比较.
+func (p *Comet) CompareMem(a1, a2 uint16, n int) []MemDiff {
+	var end = int(a1)
+	if a2 > a1 {
+		end = int(a2)
+	}
+	if n > MEM_SIZE-end {
+		n = MEM_SIZE - end
+	}
+
+	var diffs []MemDiff
+	for i := 0; i < n; i++ {
+		if v1, v2 := p.Mem[int(a1)+i], p.Mem[int(a2)+i]; v1 != v2 {
+			diffs = append(diffs, MemDiff{Offset: i, A: v1, B: v2})
+		}
+	}
+	return diffs
+}
+
+// 两个区域是否重叠
+func memOverlap(a1, a2 uint16, n int) bool {
+	var d = int(a1) - int(a2)
+	if d < 0 {
+		d = -d
+	}
+	return a1 != a2 && d < n
+}
@@ -0,0 +1,35 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDebugCmpMem(t *testing.T) {
+	p, _ := newTestComet(t, "MAIN START\n     HALT\n     END")
+	copy(p.Mem[0x100:], []uint16{1, 2, 3, 4})
+	copy(p.Mem[0x200:], []uint16{1, 2, 9, 4})
+
+	out := runDebug(p, "cmpmem 100 200 4\ncmpmem 100 101 2\ncmpmem 100 100 4\ncmpmem 100 200\nq\n")
+	for _, want := range []string{
+		"mem[0102] = 0003\tmem[0202] = 0009\n共 1 处不同\n",
+		"注意: 两个区域重叠\nmem[0100] = 0001\tmem[0101] = 0002\nmem[0101] = 0002\tmem[0102] = 0003\n共 2 处不同\n",
+		"没有不同\n",
+		"错误: 需要两个地址和比较的字数\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+
+	// 超出内存的部分不比较
+	p.Mem[0xFFFF] = 1
+	if d := p.CompareMem(0xFFFE, 0xFFFF, 5); !reflect.DeepEqual(d, []MemDiff{{Offset: 0, A: 0, B: 1}}) {
+		t.Fatalf("CompareMem = %+v", d)
+	}
+}
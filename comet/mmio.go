@@ -0,0 +1,57 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 内存映射设备的处理函数
+//
+// 读取时write为false, 返回读到的值; 写入时write为true, val为写入的值, 返回值被忽略.
+type MMIOHandler func(addr int, write bool, val int16) int16
+
+// 映射到设备的区域[start, end)
+type mmioRegion struct {
+	start, end int
+	handler    MMIOHandler
+}
+
+// 把[start, end)区域映射到设备, 指令读写该区域时调用handler而不访问Mem
+//
+// 和已有的区域重叠时, 后映射的优先; handler为nil时取消映射.
+// 设备的读写不经过缓存模型, 也不能被反向单步回退.
+func (p *Comet) MapMMIO(start, end int, handler MMIOHandler) {
+	if start < 0 {
+		start = 0
+	}
+	if end > MEM_SIZE {
+		end = MEM_SIZE
+	}
+	if start < end {
+		p.mmio = append(p.mmio, mmioRegion{start, end, handler})
+	}
+}
+
+// 查找地址对应的设备, 没有映射时返回nil
+func (p *Comet) mmioHandler(adr uint16) MMIOHandler {
+	for i := len(p.mmio) - 1; i >= 0; i-- {
+		if r := &p.mmio[i]; int(adr) >= r.start && int(adr) < r.end {
+			return r.handler
+		}
+	}
+	return nil
+}
+
+// 通过设备读写, 没有映射时返回false
+func (p *Comet) mmioAccess(adr uint16, write bool, v uint16) (uint16, bool) {
+	if len(p.mmio) == 0 {
+		return 0, false
+	}
+	var h = p.mmioHandler(adr)
+	if h == nil {
+		return 0, false
+	}
+	if p.histCur != nil {
+		p.histCur.io = true
+	}
+	return uint16(h(int(adr), write, int16(v))), true
+}
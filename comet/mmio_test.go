@@ -0,0 +1,58 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMapMMIO(t *testing.T) {
+	// 写入F000输出一个字符, 读取F001得到已经输出的字符数
+	p, _ := newTestComet(t, `MAIN START
+     LD   GR1,C1
+     ST   GR1,#F000
+     LD   GR1,C2
+     ST   GR1,#F000
+     LD   GR2,#F001
+     HALT
+C1   DC   'h'
+C2   DC   'i'
+     END`)
+	const con, cnt = 0xF000, 0xF001
+
+	var out strings.Builder
+	var writes = 0
+	p.MapMMIO(con, cnt+1, func(addr int, write bool, val int16) int16 {
+		switch {
+		case addr == con && write:
+			out.WriteByte(byte(val))
+			writes++
+		case addr == cnt && !write:
+			return int16(writes)
+		}
+		return 0
+	})
+
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hi" || p.GR[2] != 2 {
+		t.Fatalf("输出 %q, GR2 = %d, 期望 \"hi\", 2", out.String(), p.GR[2])
+	}
+	if p.Mem[con] != 0 || p.Mem[cnt] != 0 {
+		t.Fatalf("设备的读写修改了内存: %04x %04x", p.Mem[con], p.Mem[cnt])
+	}
+
+	// 取消映射之后访问内存
+	p.MapMMIO(con, cnt+1, nil)
+	p.ResetRegs(0)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 2 || p.Mem[con] != 'i' {
+		t.Fatalf("取消映射之后 writes = %d, mem[%04x] = %04x", writes, con, p.Mem[con])
+	}
+}
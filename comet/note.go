@@ -0,0 +1,30 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 给地址添加注释(显示指令和内存数据时在行尾显示), 注释为空时删除
+func (p *Comet) SetNote(adr uint16, note string) {
+	if note == "" {
+		delete(p.notes, adr)
+		return
+	}
+	if p.notes == nil {
+		p.notes = make(map[uint16]string)
+	}
+	p.notes[adr] = note
+}
+
+// 返回地址的注释
+func (p *Comet) Note(adr uint16) string {
+	return p.notes[adr]
+}
+
+// 显示在行尾的注释
+func (p *Comet) noteSuffix(adr uint16) string {
+	if s, ok := p.notes[adr]; ok {
+		return "\t; " + s
+	}
+	return ""
+}
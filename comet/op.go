@@ -11,7 +11,7 @@ type OpType byte
 
 // COMET机器指令
 //
-// 新增的指令: MUL, DIV, MOD, HALT, SYSCALL
+// 新增的指令: MUL, DIV, MOD, HALT, LDB, LDBS, STB, CLR, CMOVZ, TEST, ADDL, SUBL, SYSCALL
 const (
 	HALT OpType = 0x00 // 停机
 	LD   OpType = 0x01 // 取数, GR = (E)
@@ -48,6 +48,18 @@ const (
 	CALL OpType = 0x19 // 调用, SP = (SP)-1，(SP) = (PC)+2，PC = E
 	RET  OpType = 0x1A // 返回, SP = (SP)+1
 
+	// 字节指令, E为字节地址: 对应字地址E/2, E为偶数时是高8位, 奇数时是低8位
+	LDB  OpType = 0x1B // 取字节, GR = (E), 高位补0
+	LDBS OpType = 0x1C // 取字节, GR = (E), 高位为符号扩展
+	STB  OpType = 0x1D // 存字节, E = (GR)的低8位
+
+	CLR   OpType = 0x1E // 清零, GR = 0, 设置FR
+	CMOVZ OpType = 0x1F // FR等于0时取数, GR = (E), 不改变FR
+	TEST  OpType = 0x20 // 位测试, (GR)&(E), 设置FR, 不改变GR
+
+	ADDL OpType = 0x21 // 逻辑相加, GR = (GR)+(E), 无符号数, 进位时设置OF
+	SUBL OpType = 0x22 // 逻辑相减, GR = (GR)-(E), 无符号数, 借位时设置OF
+
 	SYSCALL OpType = 0xFF // 系统调用, 低8bit是调用号, GR0~GR3可用于交换数据
 )
 
@@ -62,6 +74,16 @@ func (op OpType) UseGR() bool {
 	return false
 }
 
+// 指令是否写入GR寄存器
+func (op OpType) WritesGR() bool {
+	switch op {
+	case LD, LEA, ADD, SUB, ADDL, SUBL, MUL, DIV, MOD, AND, OR, EOR,
+		SLA, SRA, SLL, SRL, POP, LDB, LDBS, CLR, CMOVZ:
+		return true
+	}
+	return false
+}
+
 func (op OpType) Size() uint16 {
 	if int(op) > len(OpTab) {
 		return 0
@@ -118,9 +140,20 @@ var OpTab = [...]struct {
 	JZE: {JZE, "JZE", 2, false},
 
 	PUSH: {PUSH, "PUSH", 2, false},
-	POP:  {POP, "POP", 1, false},
+	POP:  {POP, "POP", 1, true},
 	CALL: {CALL, "CALL", 2, false},
 	RET:  {RET, "RET", 1, false},
 
+	LDB:  {LDB, "LDB", 2, true},
+	LDBS: {LDBS, "LDBS", 2, true},
+	STB:  {STB, "STB", 2, true},
+
+	CLR:   {CLR, "CLR", 1, true},
+	CMOVZ: {CMOVZ, "CMOVZ", 2, true},
+	TEST:  {TEST, "TEST", 2, true},
+
+	ADDL: {ADDL, "ADDL", 2, true},
+	SUBL: {SUBL, "SUBL", 2, true},
+
 	SYSCALL: {SYSCALL, "SYSCALL", 1, false},
 }
@@ -0,0 +1,57 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"io"
+)
+
+// RunProgram默认的输出字节数限制
+const OUTPUT_LIMIT = 1 << 20
+
+// 输出指令(系统调用和IO外设)写数据的接口, 设置了OutputLimit时统计输出的字节数
+// 记录反向单步的历史时同时记录输出的内容
+func (p *Comet) stdout() io.Writer {
+	var w = p.Stdout
+	if p.histCur != nil {
+		w = outputRecorder{w: w, rec: p.histCur}
+	}
+	if p.OutputLimit > 0 {
+		return outputLimiter{p, w}
+	}
+	return w
+}
+
+// 超过OutputLimit之后的输出被丢弃, 由checkOutput异常停机
+type outputLimiter struct {
+	p *Comet
+	w io.Writer
+}
+
+func (w outputLimiter) Write(b []byte) (int, error) {
+	var p = w.p
+	var n = len(b)
+	if left := p.OutputLimit - p.outputBytes; n > left {
+		b = b[:left]
+		p.outputOver = true
+	}
+	p.outputBytes += len(b)
+	if len(b) > 0 {
+		if _, err := w.w.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// 输出超过限制时异常停机, pc为输出指令的地址
+func (p *Comet) checkOutput(pc uint16) bool {
+	if !p.outputOver {
+		return true
+	}
+	p.outputOver = false
+	p.faultAt(pc, FaultOutputLimit, "%w：mem[%x] 输出超过 %d 字节", ErrOutputLimit, pc, p.OutputLimit)
+	return false
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOutputLimit(t *testing.T) {
+	const src = `MAIN START
+L    LEA  GR0,S
+     LEA  GR1,3
+     SYSCALL 4
+     JMP  L
+S    DC   65
+     DC   66
+     DC   67
+     END`
+
+	p, out := newTestComet(t, src)
+	p.OutputLimit = 10
+	err := p.Run()
+	wantFault(t, err, FaultOutputLimit)
+	if out.String() != "ABCABCABCA" || p.Fault().PC != 4 {
+		t.Fatalf("输出 %q, 出错地址 %04x, 期望在第4次输出时停止", out, p.Fault().PC)
+	}
+
+	// RunProgram默认限制为OUTPUT_LIMIT
+	prog, _, err := Assemble(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, s, err := RunProgram(prog, nil, 10000000)
+	if !errors.Is(err, ErrOutputLimit) || len(s) != OUTPUT_LIMIT {
+		t.Fatalf("err = %v, 输出 %d 字节, 期望 %d", err, len(s), OUTPUT_LIMIT)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// 指令的执行次数
+type OpCount struct {
+	Op    OpType
+	Count int64
+}
+
+// 地址的执行次数
+type HotSpot struct {
+	PC    uint16
+	Count int64
+}
+
+// 记录执行的指令(打开Profile时, 异常停机的指令不计数)
+func (p *Comet) profileRecord(pc uint16, op OpType) {
+	if p.opCounts == nil {
+		p.opCounts = make(map[OpType]int64)
+		p.pcCounts = make(map[uint16]int64)
+	}
+	p.opCounts[op]++
+	p.pcCounts[pc]++
+}
+
+// 各指令的执行次数(需要打开Profile)
+//
+// 按次数从多到少排序, 次数相同时按指令码排序, 输出不依赖map的遍历顺序.
+func (p *Comet) OpCounts() []OpCount {
+	var counts = make([]OpCount, 0, len(p.opCounts))
+	for op, n := range p.opCounts {
+		counts = append(counts, OpCount{Op: op, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Op < counts[j].Op
+	})
+	return counts
+}
+
+// 格式化各指令的执行次数, 顺序和OpCounts相同
+func (p *Comet) OpCountString() string {
+	var buf bytes.Buffer
+	for _, c := range p.OpCounts() {
+		fmt.Fprintf(&buf, "%-8v%d\n", c.Op, c.Count)
+	}
+	return buf.String()
+}
+
+// 执行次数最多的n个地址(需要打开Profile, n <= 0 时返回全部)
+//
+// 按次数从多到少排序, 次数相同时按地址排序.
+func (p *Comet) HotSpots(n int) []HotSpot {
+	var spots = make([]HotSpot, 0, len(p.pcCounts))
+	for pc, cnt := range p.pcCounts {
+		spots = append(spots, HotSpot{PC: pc, Count: cnt})
+	}
+	sort.Slice(spots, func(i, j int) bool {
+		if spots[i].Count != spots[j].Count {
+			return spots[i].Count > spots[j].Count
+		}
+		return spots[i].PC < spots[j].PC
+	})
+	if n > 0 && n < len(spots) {
+		spots = spots[:n]
+	}
+	return spots
+}
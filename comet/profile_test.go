@@ -0,0 +1,49 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProfileOrder(t *testing.T) {
+	p := NewComet([]uint16{
+		0x0310, 0x0003, // 0000: LEA  GR1,3
+		0x0510, 0x000d, // 0002: LOOP SUB GR1,ONE
+		0x1500, 0x0002, // 0004: JNZ  LOOP
+		0x0120, 0x000d, // 0006: LD   GR2,ONE
+		0x0420, 0x000d, // 0008: ADD  GR2,ONE
+		0x0220, 0x000e, // 000a: ST   GR2,X
+		0x0000, //         000c: HALT
+		0x0001, //         000d: ONE  DC 1
+		0x0000, //         000e: X    DS 1
+	}, 0)
+	p.Profile = true
+	p.Run()
+
+	// 次数相同时按指令码排序: HALT(00) < LD(01) < ST(02) < LEA(03) < ADD(04)
+	const want = "SUB     3\nJNZ     3\nHALT    1\nLD      1\nST      1\nLEA     1\nADD     1\n"
+	for i := 0; i < 10; i++ {
+		if got := p.OpCountString(); got != want {
+			t.Fatalf("OpCountString:\n%s期望:\n%s", got, want)
+		}
+	}
+
+	var spots = []HotSpot{{2, 3}, {4, 3}, {0, 1}, {6, 1}}
+	for i := 0; i < 10; i++ {
+		if got := p.HotSpots(4); !reflect.DeepEqual(got, spots) {
+			t.Fatalf("HotSpots = %v, 期望 %v", got, spots)
+		}
+	}
+	if n := len(p.HotSpots(0)); n != 7 {
+		t.Fatalf("HotSpots(0) 返回 %d 个地址, 期望 7", n)
+	}
+
+	p.Reset()
+	if s := p.OpCountString(); s != "" {
+		t.Fatalf("Reset 之后还有统计: %q", s)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+)
+
+// 读取通用寄存器GRi(0 <= i <= 4), GR4兼作栈指针
+//
+// 外部工具应优先使用GetGR/SetGR和SP/SetSP, 而不是直接访问GR字段.
+func (p *Comet) GetGR(i int) (int16, error) {
+	if i < 0 || i >= len(p.GR) {
+		return 0, fmt.Errorf("%w：GR%d (只有GR0 ~ GR4)", ErrBadRegister, i)
+	}
+	return int16(p.GR[i]), nil
+}
+
+// 修改通用寄存器GRi(0 <= i <= 4), 修改GR4和SetSP相同
+func (p *Comet) SetGR(i int, v int16) error {
+	if i < 0 || i >= len(p.GR) {
+		return fmt.Errorf("%w：GR%d (只有GR0 ~ GR4)", ErrBadRegister, i)
+	}
+	if i == 4 {
+		p.SetSP(uint16(v))
+		return nil
+	}
+	p.GR[i] = uint16(v)
+	return nil
+}
+
+// 栈指针(GR4)
+func (p *Comet) SP() uint16 {
+	return p.GR[4]
+}
+
+// 修改栈指针(GR4), 和InitSP相同(RequireSPInit时视为已经初始化)
+func (p *Comet) SetSP(sp uint16) {
+	p.InitSP(sp)
+}
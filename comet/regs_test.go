@@ -0,0 +1,58 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGetSetGR(t *testing.T) {
+	p := NewComet(nil, 0)
+	for _, i := range []int{-1, 5} {
+		if _, err := p.GetGR(i); !errors.Is(err, ErrBadRegister) {
+			t.Fatalf("GetGR(%d): err = %v", i, err)
+		}
+		if err := p.SetGR(i, 1); !errors.Is(err, ErrBadRegister) {
+			t.Fatalf("SetGR(%d): err = %v", i, err)
+		}
+	}
+
+	if err := p.SetGR(1, -2); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := p.GetGR(1); err != nil || v != -2 || p.GR[1] != 0xFFFE {
+		t.Fatalf("GetGR(1) = %d, %v", v, err)
+	}
+
+	// GR4就是SP
+	p.RequireSPInit = true
+	if err := p.SetGR(4, 0x1000); err != nil {
+		t.Fatal(err)
+	}
+	if p.SP() != 0x1000 || !p.spInitialized {
+		t.Fatalf("SP = %04x, 期望 1000 并且已经初始化", p.SP())
+	}
+}
+
+func TestDebugSetReg(t *testing.T) {
+	p, _ := newTestComet(t, "MAIN START\n     HALT\n     END")
+	out := runDebug(p, "setreg GR1 10\nsetreg sp f000\nsetreg GR5 1\nsetreg GR1\nsetreg GR2 zz\nq\n")
+	for _, want := range []string{
+		"修改寄存器 GR1 = 0010\n",
+		"修改寄存器 SP = f000\n",
+		"错误: 虚拟机没有实现寄存器 GR5",
+		"错误: 需要寄存器和数值",
+		"错误: 无效的数值 zz",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+	if p.GR[1] != 0x10 || p.SP() != 0xF000 {
+		t.Fatalf("GR1 = %04x, SP = %04x", p.GR[1], p.SP())
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 重定位程序: 将程序从oldBase地址移动到newBase地址
+//
+// relocs是程序中需要重定位的绝对地址(一般是指令的操作数)的下标,
+// 这些位置的值会加上两个基地址的差值(按16位回绕), 超出程序范围的下标被忽略.
+// 返回新的程序, 原来的程序不会被修改.
+func Relocate(prog []uint16, relocs []int, oldBase, newBase int) []uint16 {
+	var delta = uint16(newBase - oldBase)
+	var code = append([]uint16(nil), prog...)
+
+	for _, i := range relocs {
+		if i >= 0 && i < len(code) {
+			code[i] += delta
+		}
+	}
+
+	return code
+}
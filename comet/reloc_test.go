@@ -0,0 +1,37 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"testing"
+)
+
+func TestRelocate(t *testing.T) {
+	prog, _ := assembleTest(t, `MAIN START
+     JMP  L
+     HALT
+L    LEA  GR1,1
+     HALT
+     END`)
+
+	code := Relocate(prog, []int{1, 100}, 0, 0x100)
+	if code[1] != 0x103 {
+		t.Fatalf("跳转地址 = %x, 期望 103", code[1])
+	}
+	if prog[1] != 3 {
+		t.Fatalf("原来的程序被修改: %x", prog[1])
+	}
+
+	p, err := NewSegmented([]Segment{{Addr: 0x100, Data: code}}, 0x100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GR[1] != 1 || p.PC != 0x106 {
+		t.Fatalf("GR1 = %d, PC = %x, 期望 1, 106", p.GR[1], p.PC)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+)
+
+// 一步执行的修改(RecordSteps)
+type StepDelta struct {
+	From uint16 // 执行的指令地址
+
+	// 执行之后的状态
+	PC         uint16
+	FR         int16
+	GR         [5]uint16
+	Shutdown   bool
+	ExitCode   int
+	Overflow   bool
+	InstrCount int64
+	Cycles     int64
+	CallDepth  int
+	StackTop   uint16 // 栈顶(栈为空时指令设置SP会修改)
+
+	Mem []MemWrite // 写入的内存(按写入顺序)
+}
+
+// 一次内存写入
+type MemWrite struct {
+	Addr uint16
+	Old  uint16 // 写入之前的值
+	New  uint16 // 写入的值
+}
+
+// 返回记录的每一步的修改(需要设置RecordSteps)
+func (p *Comet) StepLog() []StepDelta {
+	return p.stepLog
+}
+
+// 开始记录一步(由StepRun调用)
+func (p *Comet) stepBegin() {
+	p.stepLog = append(p.stepLog, StepDelta{From: p.PC})
+	p.stepCur = &p.stepLog[len(p.stepLog)-1]
+}
+
+// 完成一步的记录
+func (p *Comet) stepEnd() {
+	var d = p.stepCur
+	d.PC, d.FR, d.GR = p.PC, p.FR, p.GR
+	d.Shutdown, d.ExitCode, d.Overflow = p.Shutdown, p.ExitCode, p.Overflow
+	d.InstrCount, d.Cycles = p.InstrCount, p.Cycles
+	d.CallDepth, d.StackTop = p.callDepth, p.spTop
+	p.stepCur = nil
+}
+
+// 记录内存写入
+func (p *Comet) logStepWrite(adr, v uint16) {
+	p.stepCur.Mem = append(p.stepCur.Mem, MemWrite{Addr: adr, Old: p.Mem[adr], New: v})
+}
+
+// 修改IO_FLAG(不经过缓存模型)
+func (p *Comet) setIOFlag(v uint16) {
+	if p.stepCur != nil {
+		p.logStepWrite(IO_FLAG, v)
+	}
+	if p.histCur != nil {
+		p.histCur.mem = append(p.histCur.mem, memDelta{IO_FLAG, p.Mem[IO_FLAG]})
+	}
+	p.Mem[IO_FLAG] = v
+}
+
+// 从初始状态开始应用记录的前step步, 重建当时的虚拟机状态(不重新执行指令)
+//
+// 每一步都检查执行的指令地址和写入之前的内存, 和记录不一致时返回错误.
+// 返回的虚拟机使用默认的输入输出和系统调用函数(和NewComet相同).
+func ReplayFrom(initial *VMState, log []StepDelta, step int) (*Comet, error) {
+	if step < 0 || step > len(log) {
+		return nil, fmt.Errorf("步数 %d 超出记录的范围(0 ~ %d)", step, len(log))
+	}
+
+	var p = NewComet(nil, 0)
+	p.Restore(initial)
+	for i, d := range log[:step] {
+		if d.From != p.PC {
+			return nil, fmt.Errorf("第 %d 步: 记录的指令地址 %04x 和 PC(%04x) 不一致", i+1, d.From, p.PC)
+		}
+		for _, w := range d.Mem {
+			if p.Mem[w.Addr] != w.Old {
+				return nil, fmt.Errorf("第 %d 步: mem[%04x] 是 %04x, 记录的是 %04x", i+1, w.Addr, p.Mem[w.Addr], w.Old)
+			}
+			p.Mem[w.Addr] = w.New
+		}
+		p.PC, p.FR, p.GR = d.PC, d.FR, d.GR
+		p.Shutdown, p.ExitCode, p.Overflow = d.Shutdown, d.ExitCode, d.Overflow
+		p.InstrCount, p.Cycles = d.InstrCount, d.Cycles
+		p.callDepth, p.spTop = d.CallDepth, d.StackTop
+	}
+	return p, nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplayFrom(t *testing.T) {
+	p, _ := newTestComet(t, snapshotTestSrc)
+	p.RecordSteps = true
+	initial := p.Snapshot()
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	log := p.StepLog()
+	if int64(len(log)) != p.InstrCount {
+		t.Fatalf("记录了 %d 步, 执行了 %d 条指令", len(log), p.InstrCount)
+	}
+
+	for _, k := range []int{0, 1, 7, 20, len(log)} {
+		r, err := ReplayFrom(initial, log, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 重新执行到第k步
+		q, _ := newTestComet(t, snapshotTestSrc)
+		if k > 0 {
+			q.BreakAtStep(k)
+			if err := q.Run(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got, want := r.Snapshot(), q.Snapshot(); *got != *want {
+			t.Errorf("第 %d 步: PC = %04x, GR = %v, 期望 PC = %04x, GR = %v", k, got.PC, got.GR, want.PC, want.GR)
+		}
+	}
+
+	if _, err := ReplayFrom(initial, log, len(log)+1); err == nil {
+		t.Fatal("超出范围的步数没有报错")
+	}
+
+	// 初始状态和记录不一致
+	var bad = *initial
+	bad.Mem[0x13] = 1
+	if _, err := ReplayFrom(&bad, log, len(log)); err == nil || !strings.Contains(err.Error(), "mem[0013]") {
+		t.Fatalf("err = %v", err)
+	}
+	bad = *initial
+	bad.PC = 2
+	if _, err := ReplayFrom(&bad, log, 1); err == nil || !strings.Contains(err.Error(), "第 1 步") {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// 从0地址载入并运行程序, 返回停机后的虚拟机和程序的输出
+//
+// input中的数依次作为READ(或十进制IO)的输入(没有更多输入时读到0), 输出最多OUTPUT_LIMIT字节.
+// maxSteps是最多执行的指令数目(小于等于0表示不限制), 超过时返回ErrStepLimitExceeded.
+func RunProgram(prog []int16, input []int16, maxSteps int) (*Comet, string, error) {
+	p, out := newProgram(prog, input, maxSteps)
+	err := p.Run()
+	return p, out.String(), err
+}
+
+// 创建RunProgram使用的虚拟机, 返回虚拟机和保存输出的Buffer
+func newProgram(prog []int16, input []int16, maxSteps int) (*Comet, *bytes.Buffer) {
+	var code = make([]uint16, len(prog))
+	for i, v := range prog {
+		code[i] = uint16(v)
+	}
+
+	var out bytes.Buffer
+	p := NewComet(code, 0)
+	p.Stdin = bufio.NewReader(strings.NewReader(""))
+	p.Stdout = &out
+	p.OutputLimit = OUTPUT_LIMIT
+	if maxSteps > 0 {
+		p.MaxSteps = int64(maxSteps)
+	}
+	for _, v := range input {
+		p.QueueInput(fmt.Sprintf("%d\n", v))
+	}
+	return p, &out
+}
+
+// 批量运行的选项
+type BatchOptions struct {
+	MaxSteps int  // 每组输入最多执行的指令数目(小于等于0表示不限制)
+	Mix      bool // 统计各指令的执行次数(BatchResult.Mix)
+}
+
+// 批量运行中一组输入的结果
+type BatchResult struct {
+	Output     string    // 程序的输出
+	ExitCode   int       // 退出码
+	InstrCount int64     // 执行的指令数目
+	Err        error     // 异常停机或超过指令数目(ErrStepLimitExceeded)
+	Mix        []OpCount // 各指令的执行次数(BatchOptions.Mix), 顺序和OpCounts相同
+}
+
+// 在每组输入下运行程序(和RunProgram相同), 返回每组输入的结果
+//
+// 用于自动评分: 打开Mix时可以检查程序使用的指令(比如应该用移位的地方用了MUL),
+// 或者指令数目是否异常.
+func RunBatch(prog []int16, inputs [][]int16, opt BatchOptions) []BatchResult {
+	var results = make([]BatchResult, len(inputs))
+	for i, input := range inputs {
+		p, out := newProgram(prog, input, opt.MaxSteps)
+		p.Profile = opt.Mix
+
+		err := p.Run()
+		results[i] = BatchResult{
+			Output:     out.String(),
+			ExitCode:   p.ExitCode,
+			InstrCount: p.InstrCount,
+			Err:        err,
+		}
+		if opt.Mix {
+			results[i].Mix = p.OpCounts()
+		}
+	}
+	return results
+}
+
+// 检查程序在每组输入下是否在maxSteps条指令之内停机(包括异常停机)
+//
+// 这只是有界的检查: 返回false表示某组输入超过了maxSteps还没有停机,
+// 可能是死循环, 也可能只是需要更多的指令; 并不能判定程序是否一定停机.
+func Terminates(prog []int16, inputs [][]int16, maxSteps int) bool {
+	for _, input := range inputs {
+		_, _, err := RunProgram(prog, input, maxSteps)
+		if errors.Is(err, ErrStepLimitExceeded) {
+			return false
+		}
+	}
+	return true
+}
+
+// 比较两个程序在每组输入下的行为是否相同
+//
+// 比较输出, 退出码和程序区之外的数据区(两个程序中较大者之后到SP_MIN).
+// 程序区本身和栈区不比较; 任何一个程序出错或超过maxSteps时返回false.
+// 这只是测试意义上的等价, 用于检查优化之后的程序.
+func ProgramsEquivalent(a, b []int16, inputs [][]int16, maxSteps int) bool {
+	var start = len(a)
+	if len(b) > start {
+		start = len(b)
+	}
+
+	for _, input := range inputs {
+		pa, outa, err := RunProgram(a, input, maxSteps)
+		if err != nil {
+			return false
+		}
+		pb, outb, err := RunProgram(b, input, maxSteps)
+		if err != nil {
+			return false
+		}
+
+		if outa != outb || pa.ExitCode != pb.ExitCode {
+			return false
+		}
+		for adr := start; adr < SP_MIN; adr++ {
+			if pa.Mem[adr] != pb.Mem[adr] {
+				return false
+			}
+		}
+	}
+	return true
+}
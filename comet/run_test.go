@@ -0,0 +1,131 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestRunBatchMix(t *testing.T) {
+	// 读入n, 输出n*2, 退出码为n
+	code := []uint16{
+		0xFF01,         // 0000: SYSCALL 1
+		0x0200, 0x0009, // 0001: ST   GR0,N
+		0x0600, 0x000a, // 0003: MUL  GR0,TWO
+		0xFF02,         // 0005: SYSCALL 2
+		0x0100, 0x0009, // 0006: LD   GR0,N
+		0xFF05, // 0008: SYSCALL 5
+		0x0000, // 0009: N    DS 1
+		0x0002, // 000a: TWO  DC 2
+	}
+	prog := make([]int16, len(code))
+	for i, v := range code {
+		prog[i] = int16(v)
+	}
+
+	results := RunBatch(prog, [][]int16{{3}, {5}}, BatchOptions{MaxSteps: 100, Mix: true})
+	if len(results) != 2 {
+		t.Fatalf("%d 个结果, 期望 2", len(results))
+	}
+	for i, want := range []struct {
+		out  string
+		code int
+	}{{"6\n", 3}, {"10\n", 5}} {
+		r := results[i]
+		if r.Err != nil || r.Output != want.out || r.ExitCode != want.code || r.InstrCount != 6 {
+			t.Errorf("%d: %+v, 期望输出 %q, 退出码 %d", i, r, want.out, want.code)
+		}
+		var mix = []OpCount{{SYSCALL, 3}, {LD, 1}, {ST, 1}, {MUL, 1}}
+		if !reflect.DeepEqual(r.Mix, mix) {
+			t.Errorf("%d: 指令统计 %v, 期望 %v", i, r.Mix, mix)
+		}
+	}
+
+	// 默认不统计
+	loop := []int16{0x1200, 0x0000} // 0000: L JMP L
+	results = RunBatch(loop, [][]int16{nil}, BatchOptions{MaxSteps: 10})
+	if r := results[0]; r.Mix != nil || !errors.Is(r.Err, ErrStepLimitExceeded) {
+		t.Fatalf("%+v, 期望没有指令统计并且超过指令数目", r)
+	}
+}
+
+func TestProgramsEquivalent(t *testing.T) {
+	// 读入n, 输出n*2(n保存在#100)
+	const tmpl = `MAIN START
+     SYSCALL 1
+     ST   GR0,#%s
+     %s
+     SYSCALL 2
+     HALT
+TWO  DC   2
+ONE  DC   1
+     END`
+	var progs = make(map[string][]int16)
+	for name, x := range map[string][2]string{
+		"mul":   {"100", "MUL  GR0,TWO"},
+		"shift": {"100", "SLL  GR0,ONE"},
+		"add1":  {"100", "ADD  GR0,ONE"},
+		"mem":   {"101", "MUL  GR0,TWO"},
+	} {
+		prog, _, err := Assemble(fmt.Sprintf(tmpl, x[0], x[1]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		progs[name] = prog
+	}
+	var inputs = [][]int16{{0}, {1}, {7}, {1000}}
+
+	if !ProgramsEquivalent(progs["mul"], progs["shift"], inputs, 100) {
+		t.Fatal("MUL和SLL的版本应该等价")
+	}
+	if ProgramsEquivalent(progs["mul"], progs["add1"], inputs, 100) {
+		t.Fatal("输出不同的程序被认为等价")
+	}
+	if ProgramsEquivalent(progs["mul"], progs["mem"], inputs, 100) {
+		t.Fatal("数据区不同的程序被认为等价")
+	}
+	if ProgramsEquivalent(progs["mul"], progs["shift"], inputs, 3) {
+		t.Fatal("超过指令数目的程序被认为等价")
+	}
+}
+
+func TestTerminates(t *testing.T) {
+	halt, _, err := Assemble(`MAIN START
+     SYSCALL 1
+     CPA  GR0,ZERO
+     JZE  Z
+     SYSCALL 2
+Z    HALT
+ZERO DC   0
+     END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 输入为0时死循环
+	loop, _, err := Assemble(`MAIN START
+     SYSCALL 1
+     CPA  GR0,ZERO
+L    JZE  L
+     HALT
+ZERO DC   0
+     END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inputs = [][]int16{{1}, {0}}
+	if !Terminates(halt, inputs, 100) {
+		t.Fatal("停机的程序被认为不停机")
+	}
+	if Terminates(loop, inputs, 1000) {
+		t.Fatal("死循环被认为停机")
+	}
+	if !Terminates(loop, inputs[:1], 1000) {
+		t.Fatal("没有进入死循环的输入被认为不停机")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// 虚拟机的执行状态(Snapshot/Restore)
+//
+// 只保存CPU(包括整个内存)和停机状态, 不包括输入输出, 系统调用函数,
+// 缓存模型和调试器的设置. GR[4]就是SP.
+type VMState struct {
+	CPU
+
+	Shutdown   bool  // 已经关机
+	ExitCode   int   // 退出码
+	Overflow   bool  // 最近一次算术运算是否溢出
+	InstrCount int64 // 已经执行的指令数目
+	Cycles     int64 // 已经消耗的时钟周期
+
+	err    error
+	spInit bool
+	spTop  uint16
+	depth  int
+}
+
+// 保存当前的执行状态
+//
+// 每个快照都复制整个内存(约128KB), 频繁保存时要注意内存的使用.
+func (p *Comet) Snapshot() *VMState {
+	return &VMState{
+		CPU:        p.CPU,
+		Shutdown:   p.Shutdown,
+		ExitCode:   p.ExitCode,
+		Overflow:   p.Overflow,
+		InstrCount: p.InstrCount,
+		Cycles:     p.Cycles,
+		err:        p.err,
+		spInit:     p.spInitialized,
+		spTop:      p.spTop,
+		depth:      p.callDepth,
+	}
+}
+
+// 恢复到快照的执行状态
+//
+// 反向单步的历史记录被清空, 监视点按恢复之后的内存重新记录.
+// 已经输出的内容和已经读取的输入不会恢复.
+func (p *Comet) Restore(s *VMState) {
+	p.CPU = s.CPU
+	p.Shutdown, p.ExitCode = s.Shutdown, s.ExitCode
+	p.Overflow = s.Overflow
+	p.InstrCount, p.Cycles = s.InstrCount, s.Cycles
+	p.err, p.spInitialized, p.spTop = s.err, s.spInit, s.spTop
+	p.callDepth = s.depth
+
+	p.histNext, p.histLen = 0, 0
+	p.breakAt = 0
+	for adr := range p.watches {
+		p.watches[adr] = p.Mem[adr]
+	}
+}
+
+// VMState的JSON格式, 内存只保存非0的单元
+type vmStateJSON struct {
+	PC         uint16    `json:"pc"`
+	FR         int16     `json:"fr"`
+	GR         [5]uint16 `json:"gr"`
+	SP         uint16    `json:"sp"`
+	Shutdown   bool      `json:"shutdown"`
+	ExitCode   int       `json:"exitCode"`
+	Overflow   bool      `json:"overflow"`
+	InstrCount int64     `json:"instrCount"`
+	Cycles     int64     `json:"cycles"`
+	SPInit     bool      `json:"spInit"`
+	StackTop   uint16    `json:"stackTop"`
+	CallDepth  int       `json:"callDepth"`
+	Error      string    `json:"error,omitempty"`
+	Mem        []memCell `json:"mem"`
+}
+
+type memCell struct {
+	Addr  uint16 `json:"addr"`
+	Value uint16 `json:"value"`
+}
+
+// 输出JSON格式(用于网页等可视化工具)
+//
+// 内存只输出非0的单元({addr, value}数组), sp和gr[4]相同, stackTop是栈顶的初始值(POP/RET的上限).
+// 停机的错误只保存错误信息, 读回之后不能再用errors.Is判断错误类型.
+func (s VMState) MarshalJSON() ([]byte, error) {
+	var v = vmStateJSON{
+		PC:         s.PC,
+		FR:         s.FR,
+		GR:         s.GR,
+		SP:         s.GR[4],
+		Shutdown:   s.Shutdown,
+		ExitCode:   s.ExitCode,
+		Overflow:   s.Overflow,
+		InstrCount: s.InstrCount,
+		Cycles:     s.Cycles,
+		SPInit:     s.spInit,
+		StackTop:   s.spTop,
+		CallDepth:  s.depth,
+		Mem:        []memCell{},
+	}
+	if s.err != nil {
+		v.Error = s.err.Error()
+	}
+	for adr, x := range s.Mem {
+		if x != 0 {
+			v.Mem = append(v.Mem, memCell{Addr: uint16(adr), Value: x})
+		}
+	}
+	return json.Marshal(&v)
+}
+
+// 读取MarshalJSON输出的JSON格式
+func (s *VMState) UnmarshalJSON(data []byte) error {
+	var v vmStateJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.SP != v.GR[4] {
+		return fmt.Errorf("sp(%04x)和gr[4](%04x)不一致", v.SP, v.GR[4])
+	}
+
+	*s = VMState{
+		Shutdown:   v.Shutdown,
+		ExitCode:   v.ExitCode,
+		Overflow:   v.Overflow,
+		InstrCount: v.InstrCount,
+		Cycles:     v.Cycles,
+		spInit:     v.SPInit,
+		spTop:      v.StackTop,
+		depth:      v.CallDepth,
+	}
+	if s.spTop == 0 {
+		s.spTop = SP_START // 没有stackTop的旧格式
+	}
+	s.PC, s.FR, s.GR = v.PC, v.FR, v.GR
+	for _, c := range v.Mem {
+		s.Mem[c.Addr] = c.Value
+	}
+	if v.Error != "" {
+		s.err = errors.New(v.Error)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// 计算 1+2+...+10, 中间结果写入内存
+const snapshotTestSrc = `MAIN START
+     LEA  GR1,0
+     LEA  GR2,0
+L    LEA  GR1,1,GR1
+     ST   GR1,GR1V
+     ADD  GR2,GR1V
+     ST   GR2,SUM
+     PUSH 0,GR2
+     CPA  GR1,TEN
+     JNZ  L
+     HALT
+GR1V DC   0
+SUM  DC   0
+TEN  DC   10
+     END`
+
+func TestSnapshotRestore(t *testing.T) {
+	p, _ := newTestComet(t, snapshotTestSrc)
+	p.BreakAtStep(20)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s := p.Snapshot()
+
+	if err := p.Run(); err != nil || !p.Shutdown {
+		t.Fatalf("err = %v, 没有运行到停机", err)
+	}
+	var final = p.Snapshot()
+
+	// 快照不受之后执行的影响
+	if s.Shutdown || s.InstrCount != 20 || s.CPU == final.CPU {
+		t.Fatalf("快照被修改: InstrCount = %d, Shutdown = %v", s.InstrCount, s.Shutdown)
+	}
+
+	for i := 0; i < 2; i++ {
+		p.Restore(s)
+		if p.Shutdown || p.InstrCount != 20 || p.CPU != s.CPU {
+			t.Fatalf("恢复之后 PC = %04x, InstrCount = %d", p.PC, p.InstrCount)
+		}
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Snapshot(); *got != *final {
+			t.Fatalf("第 %d 次恢复之后的结果不同: PC = %04x, GR = %v, 期望 PC = %04x, GR = %v", i+1, got.PC, got.GR, final.PC, final.GR)
+		}
+	}
+	if p.Mem[0x14] != 55 {
+		t.Fatalf("SUM = %d, 期望 55", p.Mem[0x14])
+	}
+}
+
+func TestVMStateJSON(t *testing.T) {
+	p, _ := newTestComet(t, snapshotTestSrc)
+	p.BreakAtStep(20)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	s := p.Snapshot()
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), `"addr"`) > 100 {
+		t.Fatalf("内存没有按非0单元输出: %d 字节", len(data))
+	}
+
+	var got VMState
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != *s {
+		t.Fatalf("读回的状态不同: PC = %04x, GR = %v, 期望 PC = %04x, GR = %v", got.PC, got.GR, s.PC, s.GR)
+	}
+
+	// 从读回的状态继续执行, 结果和没有中断时相同
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var want = p.Snapshot()
+	p.Restore(&got)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if *p.Snapshot() != *want {
+		t.Fatalf("继续执行的结果不同: GR = %v, 期望 %v", p.GR, want.GR)
+	}
+
+	if err := json.Unmarshal([]byte(`{"gr":[0,0,0,0,1],"sp":2}`), &got); err == nil {
+		t.Fatal("sp和gr[4]不一致时没有报错")
+	}
+}
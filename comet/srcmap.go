@@ -0,0 +1,72 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// 指令对应的源代码行
+type SourceLine struct {
+	Line int    // 行号
+	Text string // 源代码
+}
+
+// 源代码行映射(指令地址到源代码行)
+type SourceMap map[uint16]SourceLine
+
+// 读取casl汇编器(-map参数)生成的映射文件
+//
+// 每行为: 地址(十六进制) 行号 源代码, 用TAB分隔.
+func ReadSourceMap(r io.Reader) (SourceMap, error) {
+	var m = make(SourceMap)
+	var scanner = bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		if scanner.Text() == "" {
+			continue
+		}
+		fields := strings.SplitN(scanner.Text(), "\t", 3)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("映射文件第 %d 行格式错误", lineno)
+		}
+		adr, err1 := strconv.ParseUint(fields[0], 16, 16)
+		ln, err2 := strconv.Atoi(fields[1])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("映射文件第 %d 行格式错误", lineno)
+		}
+		m[uint16(adr)] = SourceLine{Line: ln, Text: strings.TrimSpace(fields[2])}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// 读取映射文件
+func LoadSourceMap(filename string) (SourceMap, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSourceMap(f)
+}
+
+// 格式化pc位置的指令, src为true时在行尾显示对应的源代码
+func (p *Comet) formatTrace(pc uint16, src bool) string {
+	var s = p.FormatInstruction(pc, 1)
+	if !src {
+		return s
+	}
+	if x, ok := p.Source[pc]; ok {
+		s = strings.TrimSuffix(s, "\n") + fmt.Sprintf("\t; 第 %d 行: %s\n", x.Line, x.Text)
+	}
+	return s
+}
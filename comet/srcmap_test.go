@@ -0,0 +1,43 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTraceSource(t *testing.T) {
+	const src = `MAIN START
+     LEA  GR1,1
+     HALT
+     END`
+
+	// 没有映射文件时不能打开
+	p, _ := newTestComet(t, src)
+	out := runDebug(p, "t src\nq\n")
+	if !strings.Contains(out, "错误: 没有载入源代码行映射") {
+		t.Fatalf("没有映射文件时打开了源代码显示:\n%s", out)
+	}
+
+	m, err := ReadSourceMap(strings.NewReader("0000\t2\t合計 LEA GR1,1\n\n0002\t3\tHALT\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 2 || m[2] != (SourceLine{Line: 3, Text: "HALT"}) {
+		t.Fatalf("映射错误: %v", m)
+	}
+
+	p, _ = newTestComet(t, src)
+	p.Source = m
+	out = runDebug(p, "t\nt src\ns\nq\n")
+	if want := "LEA GR1, 0001\t; 第 2 行: 合計 LEA GR1,1\n"; !strings.Contains(out, want) {
+		t.Fatalf("跟踪没有显示源代码 %q:\n%s", want, out)
+	}
+
+	if _, err := ReadSourceMap(strings.NewReader("0000\t2\n")); err == nil {
+		t.Fatal("格式错误的映射文件没有报错")
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 检查PUSH/CALL是否会使SP低于StackFloor(0表示不检查), 溢出时异常停机并返回false
+//
+// 栈顶不高于StackFloor时(栈不在栈区)不检查.
+func (p *Comet) checkPush() bool {
+	if p.StackFloor != 0 && p.spTop > p.StackFloor && p.GR[4] <= p.StackFloor {
+		p.fault(FaultStackOverflow, "mem[%x]: %w：SP = %x (下限 %x)", p.PC, ErrStackOverflow, p.GR[4], p.StackFloor)
+		return false
+	}
+	return true
+}
+
+// 检查POP/RET是否会使SP高于栈顶的初始值, 下溢时异常停机并返回false
+func (p *Comet) checkPop() bool {
+	if p.GR[4] >= p.spTop {
+		p.fault(FaultStackUnderflow, "mem[%x]: %w：SP = %x (栈为空)", p.PC, ErrStackUnderflow, p.GR[4])
+		return false
+	}
+	return true
+}
+
+// 调用深度: 已经执行的CALL减去RET的次数(不小于0)
+//
+// 栈中还有PUSH的数据, 所以按CALL/RET计数比按SP估计更准确.
+func (p *Comet) CallDepth() int {
+	return p.callDepth
+}
+
+// 复制栈的内容(从SP到栈顶的初始值, 第0个元素是栈顶), 栈为空时返回空切片
+func (p *Comet) StackCopy() []int16 {
+	var sp = int(p.GR[4])
+	if sp >= int(p.spTop) {
+		return []int16{}
+	}
+
+	var stack = make([]int16, int(p.spTop)-sp)
+	for i := range stack {
+		stack[i] = int16(p.Mem[sp+i])
+	}
+	return stack
+}
+
+// 恢复StackCopy复制的栈, SP设置为栈顶的初始值减去len(stack)
+//
+// 只写栈区的内存, 不经过零页保护和缓存模型.
+// 超出栈区(StackFloor到栈顶的初始值, StackFloor为0时以SP_MIN为下限)的部分被忽略.
+func (p *Comet) StackRestore(stack []int16) {
+	var floor = int(p.StackFloor)
+	if floor == 0 {
+		floor = SP_MIN
+	}
+	var n = int(p.spTop) - floor
+	if n < 0 {
+		n = 0
+	}
+	if len(stack) > n {
+		stack = stack[len(stack)-n:]
+	}
+
+	var sp = int(p.spTop) - len(stack)
+	for i, v := range stack {
+		p.Mem[sp+i] = uint16(v)
+	}
+	p.GR[4] = uint16(sp)
+}
@@ -0,0 +1,369 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// 程序中的一行: 机器码和标号, ref不为空时最后一个字是该标号的地址
+type stackLine struct {
+	label string
+	words []uint16
+	ref   string
+}
+
+// 随机生成配对的栈操作(PUSH/POP和CALL/RET), 子程序追加到subs
+type stackProgGen struct {
+	r    *rand.Rand
+	subs []stackLine
+	nsub int
+}
+
+func (g *stackProgGen) body(depth int) []stackLine {
+	var lines []stackLine
+	for i := g.r.Intn(4); i > 0; i-- {
+		switch g.r.Intn(3) {
+		case 0:
+			lines = append(lines, stackLine{words: []uint16{uint16(PUSH) << 8, 0}, ref: "V"})
+			lines = append(lines, g.body(depth+1)...)
+			lines = append(lines, stackLine{words: []uint16{uint16(POP)<<8 | uint16(g.r.Intn(4))<<4}})
+		case 1:
+			if depth >= 4 {
+				continue
+			}
+			id := g.nsub
+			g.nsub++
+			lines = append(lines, stackLine{words: []uint16{uint16(CALL) << 8, 0}, ref: fmt.Sprintf("P%d", id)})
+			sub := []stackLine{
+				{label: fmt.Sprintf("P%d", id), words: []uint16{0}, ref: fmt.Sprintf("S%d", id)},
+				{label: fmt.Sprintf("S%d", id), words: []uint16{uint16(LEA)<<8 | 0x10, uint16(id)}},
+			}
+			sub = append(sub, g.body(depth+1)...)
+			g.subs = append(g.subs, append(sub, stackLine{words: []uint16{uint16(RET) << 8}})...)
+		default:
+			lines = append(lines, stackLine{words: []uint16{uint16(LEA)<<8 | 0x20, 1}})
+		}
+	}
+	return lines
+}
+
+// 生成程序(从0地址开始执行)
+func (g *stackProgGen) program() []uint16 {
+	var lines = g.body(0)
+	lines = append(lines, stackLine{words: []uint16{uint16(HALT) << 8}})
+	lines = append(lines, g.subs...)
+	lines = append(lines, stackLine{label: "V", words: []uint16{0x1234}})
+
+	var labels = make(map[string]uint16)
+	var adr uint16
+	for _, l := range lines {
+		if l.label != "" {
+			labels[l.label] = adr
+		}
+		adr += uint16(len(l.words))
+	}
+
+	var prog []uint16
+	for _, l := range lines {
+		prog = append(prog, l.words...)
+		if l.ref != "" {
+			prog[len(prog)-1] = labels[l.ref]
+		}
+	}
+	return prog
+}
+
+func TestStackBalanced(t *testing.T) {
+	var r = rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		g := &stackProgGen{r: r}
+		prog := g.program()
+
+		sp := uint16(SP_START)
+		if i%2 == 1 {
+			sp -= uint16(r.Intn(SP_START - SP_MIN - 0x100))
+		}
+		p := NewComet(prog, 0)
+		p.GR[4] = sp
+
+		for steps := 0; !p.Shutdown && steps < 100000; steps++ {
+			p.StepRun()
+		}
+		if !p.Shutdown || p.err != nil {
+			t.Fatalf("%d: 没有正常停机: %v\n%04x", i, p.err, prog)
+		}
+		if p.GR[4] != sp || p.CallDepth() != 0 {
+			t.Fatalf("%d: SP = %x, 调用深度 %d, 期望 SP = %x, 0\n%04x", i, p.GR[4], p.CallDepth(), sp, prog)
+		}
+	}
+}
+
+func TestCheckStackLD(t *testing.T) {
+	const src = `MAIN START
+     PUSH V
+     LD   GR1,#FBFF
+     POP  GR2
+     LD   GR3,#FBFF
+     HALT
+V    DC   7
+     END`
+
+	p, _ := newTestComet(t, src)
+	if err := p.Run(); err != nil || p.GR[3] != 7 {
+		t.Fatalf("没有打开CheckStackLD: err = %v, GR3 = %d", err, p.GR[3])
+	}
+
+	p, _ = newTestComet(t, src)
+	p.CheckStackLD = true
+	wantFault(t, p.Run(), FaultStackRead)
+	if p.GR[1] != 7 || p.GR[2] != 7 || p.GR[3] != 0 {
+		t.Fatalf("GR1 = %d, GR2 = %d, GR3 = %d, 期望在出栈之后的LD处停止", p.GR[1], p.GR[2], p.GR[3])
+	}
+}
+
+func TestRequireSPInit(t *testing.T) {
+	const sub = `
+     HALT
+S    RET
+P    DC   S
+     END`
+
+	p, _ := newTestComet(t, "MAIN START\n     CALL P"+sub)
+	p.RequireSPInit = true
+	err := p.Run()
+	wantFault(t, err, FaultStackUninitialized)
+	if !errors.Is(err, ErrStackUninitialized) || !strings.Contains(err.Error(), "是否忘记设置GR4") {
+		t.Fatalf("err = %v, 期望 %v", err, ErrStackUninitialized)
+	}
+
+	p, _ = newTestComet(t, "MAIN START\n     LEA  GR4,#FC00\n     CALL P"+sub)
+	p.RequireSPInit = true
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	p, _ = newTestComet(t, "MAIN START\n     CALL P"+sub)
+	p.RequireSPInit = true
+	p.InitSP(SP_START)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStackCopyRestore(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     PUSH A
+     PUSH B
+     HALT
+A    DC   1
+B    DC   2
+     END`)
+	if s := p.StackCopy(); s == nil || len(s) != 0 {
+		t.Fatalf("空栈: %v", s)
+	}
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	saved := p.StackCopy()
+	if fmt.Sprint(saved) != "[2 1]" {
+		t.Fatalf("StackCopy = %v, 期望 [2 1]", saved)
+	}
+	saved[0] = 99
+	if p.Mem[SP_START-2] != 2 {
+		t.Fatal("修改StackCopy的结果影响了内存")
+	}
+
+	p.Mem[SP_START-1] = 7
+	p.GR[4] = SP_START - 3
+	p.StackRestore([]int16{2, 1})
+	if p.GR[4] != SP_START-2 || fmt.Sprint(p.StackCopy()) != "[2 1]" {
+		t.Fatalf("StackRestore之后 SP = %04x, 栈 = %v", p.GR[4], p.StackCopy())
+	}
+
+	p.StackRestore(nil)
+	if p.GR[4] != SP_START || len(p.StackCopy()) != 0 {
+		t.Fatalf("恢复空栈之后 SP = %04x", p.GR[4])
+	}
+}
+
+func TestFirstPush(t *testing.T) {
+	prog, entry := assembleTest(t, `MAIN START
+     PUSH V
+     HALT
+V    DC   #1234
+     END`)
+
+	for _, tt := range []struct {
+		p  *Comet
+		sp uint16
+	}{
+		{NewComet(prog, entry), SP_START},
+		{NewCometWithSP(prog, entry, 0xF800), 0xF800},
+		{NewCometWithSP(prog, entry, 0xE000), 0xE000}, // 低于SP_MIN
+		{NewComet(prog, entry, WithSP(0x1000)), 0x1000},
+	} {
+		if tt.p.GR[4] != tt.sp {
+			t.Fatalf("SP = %04x, 期望 %04x", tt.p.GR[4], tt.sp)
+		}
+		tt.p.Stdout = new(strings.Builder)
+		if err := tt.p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if tt.p.GR[4] != tt.sp-1 || tt.p.Mem[tt.sp-1] != 0x1234 || tt.p.Mem[0xFFFF] != 0 {
+			t.Fatalf("第一次PUSH之后 SP = %04x, mem[%04x] = %04x", tt.p.GR[4], tt.sp-1, tt.p.Mem[tt.sp-1])
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	// 没有结束条件的递归
+	const src = `MAIN START
+     CALL P
+     HALT
+F    PUSH 0,GR1
+     CALL P
+     RET
+P    DC   F
+     END`
+
+	p, _ := newTestComet(t, src)
+	if p.StackFloor != SP_MIN {
+		t.Fatalf("StackFloor = %04x, 期望默认为 %04x", p.StackFloor, SP_MIN)
+	}
+	err := p.Run()
+	wantFault(t, err, FaultStackOverflow)
+	if !errors.Is(err, ErrStackOverflow) || p.GR[4] != SP_MIN || p.Mem[SP_MIN-1] != 0 {
+		t.Fatalf("err = %v, SP = %04x, mem[%04x] = %04x", err, p.GR[4], SP_MIN-1, p.Mem[SP_MIN-1])
+	}
+
+	// StackFloor为0时不检查
+	p, _ = newTestComet(t, src)
+	p.StackFloor = 0
+	p.MaxSteps = 3 * (SP_START - SP_MIN)
+	if err := p.Run(); !errors.Is(err, ErrStepLimitExceeded) || p.GR[4] >= SP_MIN {
+		t.Fatalf("err = %v, SP = %04x", err, p.GR[4])
+	}
+}
+
+func TestStackUnderflow(t *testing.T) {
+	const src = `MAIN START
+     PUSH V
+     POP  GR1
+     RET
+V    DC   1
+     END`
+
+	for _, sp := range []int16{-0x400, 0x1000} { // SP_START和低于SP_MIN的栈
+		p, _ := newTestComet(t, src)
+		WithSP(sp)(p)
+		err := p.Run()
+		wantFault(t, err, FaultStackUnderflow)
+		if !errors.Is(err, ErrStackUnderflow) || p.PC != 3 || p.GR[1] != 1 || p.GR[4] != uint16(sp) {
+			t.Fatalf("SP = %04x: err = %v, PC = %04x", uint16(sp), err, p.PC)
+		}
+	}
+}
+
+func TestStackTop(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     PUSH A
+     PUSH B
+     HALT
+A    DC   1
+B    DC   2
+     END`)
+	p.InitSP(0x1000)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(p.StackCopy()); s != "[2 1]" {
+		t.Fatalf("StackCopy = %s, 期望 [2 1]", s)
+	}
+	out := runDebug(p, "tos 5\ndepth\nq\n")
+	if !strings.Contains(out, "mem[0ffe] = 0002\nmem[0fff] = 0001\n输入命令") || !strings.Contains(out, "栈中共有 2 个数据") {
+		t.Fatalf("tos和depth没有使用栈顶的初始值:\n%s", out)
+	}
+
+	p.StackFloor = 0x0FFF
+	p.StackRestore([]int16{3, 2, 1})
+	if p.GR[4] != 0x0FFF || fmt.Sprint(p.StackCopy()) != "[1]" {
+		t.Fatalf("StackRestore之后 SP = %04x, 栈 = %v", p.GR[4], p.StackCopy())
+	}
+
+	// 栈顶低于SP_MIN, StackFloor为0时不写栈区之外的内存
+	p.StackFloor = 0
+	p.StackRestore([]int16{3, 2, 1})
+	if p.GR[4] != 0x1000 || p.Mem[0x0FFF] != 1 || p.Mem[0x0FFE] != 2 {
+		t.Fatalf("StackRestore之后 SP = %04x, mem[0ffe] = %04x", p.GR[4], p.Mem[0x0FFE])
+	}
+
+	p.ResetRegs(0)
+	if p.GR[4] != 0x1000 {
+		t.Fatalf("ResetRegs之后 SP = %04x, 期望 1000", p.GR[4])
+	}
+	s := p.Snapshot()
+	q := NewComet(nil, 0)
+	q.Restore(s)
+	if q.GR[4] != 0x1000 || len(q.StackCopy()) != 0 {
+		t.Fatalf("恢复快照之后 SP = %04x, 栈 = %v", q.GR[4], q.StackCopy())
+	}
+}
+
+func TestStackRestoreFloor(t *testing.T) {
+	var stack = make([]int16, SP_START-SP_MIN+0x10)
+	for i := range stack {
+		stack[i] = int16(i + 1)
+	}
+
+	p := NewComet(nil, 0)
+	p.StackFloor = 0
+	p.StackRestore(stack)
+	if p.GR[4] != SP_MIN || p.Mem[SP_MIN] != 0x11 || p.Mem[SP_MIN-1] != 0 {
+		t.Fatalf("SP = %04x, mem[%04x] = %04x, mem[%04x] = %04x", p.GR[4], SP_MIN, p.Mem[SP_MIN], SP_MIN-1, p.Mem[SP_MIN-1])
+	}
+}
+
+func TestStackTopSetByProgram(t *testing.T) {
+	// 栈为空时LEA GR4设置新的栈顶, 子程序中调整SP不改变栈顶
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR4,#F800
+     PUSH V
+     CALL P
+     POP  GR1
+     POP  GR2
+     HALT
+S    LEA  GR4,-2,GR4
+     LEA  GR4,2,GR4
+     RET
+P    DC   S
+V    DC   7
+     END`)
+	p.HistorySize = 8
+	err := p.Run()
+	wantFault(t, err, FaultStackUnderflow)
+	if p.PC != 7 || p.GR[1] != 7 || p.GR[4] != 0xF800 || p.CallDepth() != 0 {
+		t.Fatalf("err = %v, PC = %04x, GR1 = %d, SP = %04x", err, p.PC, p.GR[1], p.GR[4])
+	}
+
+	// 回退到LEA之前恢复原来的栈顶
+	for p.PC != 0 {
+		if err := p.StepBack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.GR[4] != SP_START || len(p.StackCopy()) != 0 {
+		t.Fatalf("回退之后 SP = %04x, 栈 = %v", p.GR[4], p.StackCopy())
+	}
+	p.StepRun()
+	if s := p.StackCopy(); len(s) != 0 || p.GR[4] != 0xF800 {
+		t.Fatalf("SP = %04x, 栈 = %v", p.GR[4], s)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 标号表(标号到地址)
+type SymbolTable map[string]uint16
+
+// 读取casl汇编器(-sym参数)或WriteSymbols生成的标号表
+//
+// 每行为: 地址(十六进制) 标号, 用TAB分隔; 或者为WriteSymbols的格式.
+func ReadSymbols(r io.Reader) (SymbolTable, error) {
+	var m = make(SymbolTable)
+	var scanner = bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		if scanner.Text() == "" {
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[1] == "=" {
+			fields = []string{fields[2], fields[0]}
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("标号表第 %d 行格式错误", lineno)
+		}
+		adr, err := strconv.ParseUint(fields[0], 16, 16)
+		if err != nil {
+			return nil, fmt.Errorf("标号表第 %d 行格式错误", lineno)
+		}
+		m[fields[1]] = uint16(adr)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// 输出标号表, ReadSymbols可以读回
+//
+// 每行为: 标号 = 地址(4位十六进制), 按地址排序, 地址相同时按标号排序.
+func WriteSymbols(w io.Writer, symbols SymbolTable) error {
+	var names = make([]string, 0, len(symbols))
+	for name := range symbols {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := symbols[names[i]], symbols[names[j]]
+		if a != b {
+			return a < b
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%s = %04x\n", name, symbols[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 读取标号表文件
+func LoadSymbols(filename string) (SymbolTable, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadSymbols(f)
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDebugLabelArgs(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,1
+L    LEA  GR2,2
+     HALT
+     END`)
+	syms, err := ReadSymbols(strings.NewReader("0000\tMAIN\n0002\tL\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Symbols = syms
+
+	out := runDebug(p, "jump L\nbreak MAIN\njump NOSUCH\nq\n")
+	for _, want := range []string{"指令跳转到 2\n", "设置断点 0000\n", "错误: 缺少跳转地址\n"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+	if p.PC != 2 || len(p.Breakpoints()) != 1 || p.Breakpoints()[0] != 0 {
+		t.Fatalf("PC = %04x, 断点 %v, 期望 PC = 0002, 断点 [0]", p.PC, p.Breakpoints())
+	}
+}
+
+func TestWriteSymbols(t *testing.T) {
+	var syms = SymbolTable{"MAIN": 0, "LOOP": 0x12, "END1": 0x12, "DATA": 0xFC00}
+
+	var buf strings.Builder
+	if err := WriteSymbols(&buf, syms); err != nil {
+		t.Fatal(err)
+	}
+	const want = "MAIN = 0000\nEND1 = 0012\nLOOP = 0012\nDATA = fc00\n"
+	if buf.String() != want {
+		t.Fatalf("WriteSymbols:\n%s\n期望:\n%s", buf.String(), want)
+	}
+
+	filename := filepath.Join(t.TempDir(), "t.sym")
+	if err := os.WriteFile(filename, []byte(buf.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadSymbols(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, syms) {
+		t.Fatalf("LoadSymbols = %v, 期望 %v", got, syms)
+	}
+}
@@ -5,8 +5,12 @@
 package comet
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"log"
+	"strconv"
+	"strings"
 )
 
 // 内置的系统调用
@@ -16,7 +20,10 @@ const (
 
 	SYSCALL_IN   = 3 // 读N个字符, GR0是地址, GR1是N
 	SYSCALL_OUT  = 4 // 写N个字符, GR0是地址, GR1是N
-	SYSCALL_EXIT = 5 // 结束程序
+	SYSCALL_EXIT = 5 // 结束程序, GR0是退出码
+
+	SYSCALL_INNUM  = 6 // 读一行十进制整数(最多N个), GR0是地址, GR1是N, 读到的个数返回到GR0
+	SYSCALL_OUTNUM = 7 // 写N个十进制整数(空格分隔, 最后换行), GR0是地址, GR1是N
 
 	SYSCALL_USER_START = 64 // 用户的系统调号从此开始
 )
@@ -30,12 +37,29 @@ func init() {
 	RegisterSyscall(SYSCALL_OUT, builtinSyscall_writeStr)
 
 	RegisterSyscall(SYSCALL_EXIT, builtinSyscall_exit)
+
+	RegisterSyscall(SYSCALL_INNUM, builtinSyscall_readNums)
+	RegisterSyscall(SYSCALL_OUTNUM, builtinSyscall_writeNums)
 }
 
 // 系统调用表格
 var syscallTable [256]func(ctx *Comet)
 
-// 系统调用
+// 系统调用函数报告错误, 虚拟机异常停机(FaultSyscall), PC停留在SYSCALL指令
+//
+// 系统调用函数(Comet.Syscall)的约定:
+// 调用时PC已经指向SYSCALL的下一条指令, 函数修改PC就可以改变控制流(之后不会再增加PC);
+// 设置Shutdown为true时正常停机(比如EXIT); 出错时调用SyscallError异常停机.
+// 除此之外只应该读写GR和内存.
+func (p *Comet) SyscallError(err error) {
+	p.PC = p.syscallPC
+	p.faultAt(p.syscallPC, FaultSyscall, "mem[%x]: 系统调用 [%02x]: %w", p.syscallPC, p.syscallId, err)
+}
+
+// 标准的系统调用(NewComet的默认值), 按调用号执行RegisterSyscall注册的函数
+//
+// 内置的调用见SYSCALL_READ等常量: 数据通过GR0 ~ GR3传递,
+// 缓冲区的地址在GR0, 长度(字数)在GR1, 返回值在GR0. 没有注册的调用号什么也不做.
 func Syscall(ctx *Comet, id uint8) {
 	if fn := syscallTable[id]; fn != nil {
 		fn(ctx)
@@ -53,12 +77,15 @@ func RegisterSyscall(id uint8, syscall func(ctx *Comet)) error {
 
 // 读一个十进制整数到GR0
 func builtinSyscall_readInt(ctx *Comet) {
-	fmt.Fscanf(ctx.Stdin, "%d", ctx.GR[0])
+	var v int16
+	fmt.Fscan(ctx.stdin(), &v)
+	ctx.GR[0] = uint16(v)
 }
 
 // 输出GR10十进制格式整数
 func builtinSyscall_writeInt(ctx *Comet) {
-	fmt.Fprintln(ctx.Stdout, ctx.GR[0])
+	fmt.Fprintln(ctx.stdout(), ctx.GR[0])
+	ctx.flush()
 }
 
 // 读N个字符, GR0是地址, GR1是N
@@ -67,8 +94,10 @@ func builtinSyscall_readStr(ctx *Comet) {
 	var cnt = ctx.GR[1]
 	for i := uint16(0); i < cnt; i++ {
 		var c rune
-		fmt.Fscanf(ctx.Stdin, "%c", &c)
-		ctx.Mem[adr+i] = uint16(c)
+		fmt.Fscanf(ctx.stdin(), "%c", &c)
+		if !ctx.writeMem(adr+i, ctx.charMap().Word(c)) {
+			return
+		}
 	}
 }
 
@@ -77,11 +106,67 @@ func builtinSyscall_writeStr(ctx *Comet) {
 	var adr = ctx.GR[0]
 	var cnt = ctx.GR[1]
 	for i := uint16(0); i < cnt; i++ {
-		fmt.Fprint(ctx.Stdout, rune(ctx.Mem[adr+i]))
+		fmt.Fprintf(ctx.stdout(), "%c", ctx.charMap().Rune(ctx.Mem[adr+i]))
+	}
+	ctx.flush()
+}
+
+// 读一行十进制整数(最多N个), GR0是地址, GR1是N, 读到的个数返回到GR0
+//
+// 多余的整数被忽略, 遇到不是整数的内容时停止.
+func builtinSyscall_readNums(ctx *Comet) {
+	var adr = ctx.GR[0]
+	var cnt = ctx.GR[1]
+	var n uint16
+	for _, s := range strings.Fields(readLine(ctx.stdin())) {
+		if n >= cnt {
+			break
+		}
+		v, err := strconv.ParseInt(s, 10, 16)
+		if err != nil {
+			break
+		}
+		if !ctx.writeMem(adr+n, uint16(v)) {
+			return
+		}
+		n++
+	}
+	ctx.GR[0] = n
+}
+
+// 写N个十进制整数(有符号数, 空格分隔, 最后换行), GR0是地址, GR1是N
+func builtinSyscall_writeNums(ctx *Comet) {
+	var adr = ctx.GR[0]
+	var cnt = ctx.GR[1]
+	for i := uint16(0); i < cnt; i++ {
+		if i > 0 {
+			fmt.Fprint(ctx.stdout(), " ")
+		}
+		fmt.Fprint(ctx.stdout(), int16(ctx.Mem[adr+i]))
+	}
+	fmt.Fprintln(ctx.stdout())
+	ctx.flush()
+}
+
+// 读一行(不包括换行符)
+func readLine(r io.Reader) string {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	var line []byte
+	for {
+		c, err := br.ReadByte()
+		if err != nil || c == '\n' {
+			break
+		}
+		line = append(line, c)
 	}
+	return strings.TrimSuffix(string(line), "\r")
 }
 
-// 退出程序(和停机类似)
+// 退出程序(和停机类似), GR0是退出码
 func builtinSyscall_exit(ctx *Comet) {
+	ctx.ExitCode = int(int16(ctx.GR[0]))
 	ctx.Shutdown = true
 }
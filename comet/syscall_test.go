@@ -0,0 +1,161 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSyscallExit(t *testing.T) {
+	prog, _, err := Assemble(`MAIN START
+     LD   GR0,CODE
+     SYSCALL 5
+     SYSCALL 2
+CODE DC   2
+     END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, out, err := RunProgram(prog, nil, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ExitCode != 2 || !p.Shutdown {
+		t.Fatalf("ExitCode = %d, Shutdown = %v, 期望 2, true", p.ExitCode, p.Shutdown)
+	}
+	if out != "" {
+		t.Fatalf("EXIT之后还有输出: %q", out)
+	}
+}
+
+// 记录每次Flush时已经写入的数据
+type flushWriter struct {
+	bytes.Buffer
+	flushed []string
+}
+
+func (w *flushWriter) Flush() error {
+	w.flushed = append(w.flushed, w.String())
+	return nil
+}
+
+func TestAutoFlush(t *testing.T) {
+	const src = `MAIN START
+     LD   GR0,A
+     SYSCALL 2
+     LD   GR0,B
+     SYSCALL 2
+     HALT
+A    DC   1
+B    DC   2
+     END`
+
+	for _, autoFlush := range []bool{false, true} {
+		p, _ := newTestComet(t, src)
+		var w flushWriter
+		p.Stdout = &w
+		p.AutoFlush = autoFlush
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		var want []string
+		if autoFlush {
+			want = []string{"1\n", "1\n2\n", "1\n2\n"}
+		}
+		if len(w.flushed) != len(want) {
+			t.Fatalf("AutoFlush = %v: 刷新 %q, 期望 %q", autoFlush, w.flushed, want)
+		}
+		for i := range want {
+			if w.flushed[i] != want[i] {
+				t.Fatalf("AutoFlush = %v: 刷新 %q, 期望 %q", autoFlush, w.flushed, want)
+			}
+		}
+	}
+}
+
+func TestSyscallControlFlow(t *testing.T) {
+	var errBad = errors.New("bad syscall")
+	var handler = func(p *Comet, id uint8) {
+		switch id {
+		case 0x10: // 跳转到GR0
+			p.PC = p.GR[0]
+		case 0x11: // 停机
+			p.Shutdown = true
+		case 0x12:
+			p.SyscallError(errBad)
+		default:
+			Syscall(p, id)
+		}
+	}
+
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR0,T
+     SYSCALL 16
+     LEA  GR1,1
+T    LEA  GR2,2
+     SYSCALL 17
+     LEA  GR3,3
+     END`)
+	p.Syscall = handler
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Shutdown || p.PC != 8 || p.GR[1] != 0 || p.GR[2] != 2 || p.GR[3] != 0 {
+		t.Fatalf("PC = %04x, GR = %v, Shutdown = %v", p.PC, p.GR, p.Shutdown)
+	}
+
+	p, _ = newTestComet(t, `MAIN START
+     LEA  GR1,1
+     SYSCALL 18
+     LEA  GR2,2
+     END`)
+	p.Syscall = handler
+	err := p.Run()
+	wantFault(t, err, FaultSyscall)
+	if !errors.Is(err, errBad) || p.PC != 2 || p.Fault().PC != 2 || p.GR[2] != 0 {
+		t.Fatalf("err = %v, PC = %04x, GR2 = %04x", err, p.PC, p.GR[2])
+	}
+}
+
+func TestSyscallNums(t *testing.T) {
+	p, out := newTestComet(t, `MAIN START
+     LEA  GR0,BUF
+     LEA  GR1,4
+     SYSCALL 6
+     ST   GR0,CNT
+     LEA  GR0,BUF
+     LD   GR1,CNT
+     SYSCALL 7
+     LEA  GR0,MSG
+     LEA  GR1,3
+     SYSCALL 4
+     LEA  GR0,BUF
+     LEA  GR1,4
+     SYSCALL 6
+     HALT
+CNT  DC   0
+MSG  DC   'ok', 10
+BUF  DS   4
+     END`)
+
+	// 第一行多余的整数被忽略, 第二行遇到不是整数的内容时停止
+	p.Stdin = bufio.NewReader(strings.NewReader("12 -3 0 7 99\r\n5 x 6\n"))
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if s := out.String(); s != "12 -3 0 7\nok\n" {
+		t.Fatalf("输出 %q", s)
+	}
+	var buf = p.Mem[0x1b:0x1f]
+	if p.GR[0] != 1 || buf[0] != 5 || buf[1] != 0xFFFD || buf[3] != 7 {
+		t.Fatalf("GR0 = %d, BUF = %04x", p.GR[0], buf)
+	}
+}
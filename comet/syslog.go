@@ -0,0 +1,22 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+// 系统调用的记录
+type SyscallEvent struct {
+	PC uint16    // 系统调用指令的地址
+	Id uint8     // 系统调用号
+	GR [5]uint16 // 调用之前的寄存器
+}
+
+// 返回运行中执行过的系统调用(需要打开RecordSyscalls)
+func (p *Comet) SyscallLog() []SyscallEvent {
+	return p.syscallLog
+}
+
+// 记录系统调用
+func (p *Comet) logSyscall(pc uint16, id uint8) {
+	p.syscallLog = append(p.syscallLog, SyscallEvent{PC: pc, Id: id, GR: p.GR})
+}
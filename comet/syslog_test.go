@@ -0,0 +1,47 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyscallLog(t *testing.T) {
+	const src = `MAIN START
+     LEA  GR0,S
+     LEA  GR1,1
+     SYSCALL 4
+     LEA  GR1,2
+     SYSCALL 4
+     HALT
+S    DC   65
+     DC   66
+     END`
+
+	p, out := newTestComet(t, src)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.SyscallLog() != nil {
+		t.Fatalf("没有打开RecordSyscalls: %v", p.SyscallLog())
+	}
+
+	p, out = newTestComet(t, src)
+	p.RecordSyscalls = true
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var want = []SyscallEvent{
+		{PC: 4, Id: SYSCALL_OUT, GR: [5]uint16{0x09, 1, 0, 0, SP_START}},
+		{PC: 7, Id: SYSCALL_OUT, GR: [5]uint16{0x09, 2, 0, 0, SP_START}},
+	}
+	if log := p.SyscallLog(); !reflect.DeepEqual(log, want) {
+		t.Fatalf("SyscallLog = %+v, 期望 %+v", log, want)
+	}
+	if out.String() != "AAB" {
+		t.Fatalf("输出 %q, 期望 %q", out, "AAB")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// 汇编教学模式: 输入一条汇编指令, 立即执行并显示寄存器的变化
+func (p *Comet) teach() {
+	fmt.Fprintln(p.Stdout, "汇编教学模式 （输入空行退出）...")
+
+	for {
+		fmt.Fprint(p.Stdout, "汇编指令: ")
+		line, _, err := p.Stdin.ReadLine()
+		if err != nil {
+			return
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			fmt.Fprintln(p.Stdout, "退出汇编教学模式")
+			return
+		}
+
+		fmt.Fprint(p.Stdout, p.teachExec(string(line)))
+	}
+}
+
+// 在当前PC位置执行一条汇编指令, 返回寄存器的变化
+// 执行之后恢复指令所占的内存
+func (p *Comet) teachExec(s string) string {
+	code, err := AssembleInstruction(s)
+	if err != nil {
+		return fmt.Sprintf("错误: %v\n", err)
+	}
+
+	var (
+		pc  = p.PC
+		old = [2]uint16{p.Mem[pc], p.Mem[pc+1]}
+		gr  = p.GR
+		fr  = p.FR
+	)
+
+	copy(p.Mem[pc:], code)
+	err = p.ExecAt(int(pc))
+	p.Mem[pc], p.Mem[pc+1] = old[0], old[1]
+
+	if err != nil {
+		return fmt.Sprintf("错误: %v\n", err)
+	}
+
+	var buf bytes.Buffer
+	for i := range p.GR {
+		if p.GR[i] != gr[i] {
+			fmt.Fprintf(&buf, "GR[%d] = %04x -> %04x\n", i, gr[i], p.GR[i])
+		}
+	}
+	if p.FR != fr {
+		fmt.Fprintf(&buf, "FR    = %04x -> %04x\n", uint16(fr), uint16(p.FR))
+	}
+	fmt.Fprintf(&buf, "PC    = %04x -> %04x\n", pc, p.PC)
+	if p.Shutdown {
+		fmt.Fprintln(&buf, "已经停机")
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,33 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTeach(t *testing.T) {
+	p := NewComet([]uint16{uint16(HALT) << 8}, 0)
+	out := runDebug(p, "teach\nLEA GR1, 5\nFOO\n\nq\n")
+
+	if p.GR[1] != 5 {
+		t.Fatalf("GR1 = %d, 期望 5\n%s", p.GR[1], out)
+	}
+	for _, want := range []string{
+		"GR[1] = 0000 -> 0005",
+		"错误: 未知指令: FOO",
+		"退出汇编教学模式",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+
+	// 执行之后恢复指令所占的内存
+	if p.Mem[0] != uint16(HALT)<<8 || p.Mem[1] != 0 {
+		t.Fatalf("内存没有恢复: %04x %04x", p.Mem[0], p.Mem[1])
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 读取文本格式的程序(手写的测试程序)
+//
+// 每个字用空白分隔, 分号之后到行尾是注释. 字的格式:
+//
+//	255     十进制(默认)
+//	-1      负的十进制数按16位补码保存
+//	#00FF   十六进制(和CASL一样用#开头)
+//	0x00FF  十六进制(和Go一样用0x开头)
+//
+// 十六进制必须带前缀, 不带前缀的FF是错误, 10总是十.
+func LoadText(r io.Reader) ([]uint16, error) {
+	var prog []uint16
+	var scanner = bufio.NewScanner(r)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ';'); i >= 0 {
+			line = line[:i]
+		}
+		for _, s := range strings.Fields(line) {
+			v, err := parseTextWord(s)
+			if err != nil {
+				return nil, fmt.Errorf("第 %d 行: %v", lineno, err)
+			}
+			prog = append(prog, v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return prog, nil
+}
+
+// 解析文本格式中的一个字
+func parseTextWord(s string) (uint16, error) {
+	var hex string
+	switch {
+	case strings.HasPrefix(s, "#"):
+		hex = s[1:]
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		hex = s[2:]
+	default:
+		v, err := strconv.ParseInt(s, 10, 32)
+		if err != nil || v < -32768 || v > 0xFFFF {
+			return 0, fmt.Errorf("无效的数据 %s", s)
+		}
+		return uint16(v), nil
+	}
+
+	v, err := strconv.ParseUint(hex, 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("无效的数据 %s", s)
+	}
+	return uint16(v), nil
+}
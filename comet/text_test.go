@@ -0,0 +1,33 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadText(t *testing.T) {
+	// 同一个值的三种写法, 以及不带前缀的十进制
+	const src = `#00FF 255 0x00ff ; 注释 #1234
+-1 10 #10 0X10
+#8000 32768 -32768`
+
+	prog, err := LoadText(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want = []uint16{0xFF, 0xFF, 0xFF, 0xFFFF, 10, 0x10, 0x10, 0x8000, 0x8000, 0x8000}
+	if !reflect.DeepEqual(prog, want) {
+		t.Errorf("%04x, 期望 %04x", prog, want)
+	}
+
+	for _, s := range []string{"FF", "1A00", "#", "#-1", "0x10000", "65536", "-32769"} {
+		if _, err := LoadText(strings.NewReader("#00FF\n" + s)); err == nil || !strings.Contains(err.Error(), "第 2 行") {
+			t.Errorf("%q: err = %v, 期望第 2 行出错", s, err)
+		}
+	}
+}
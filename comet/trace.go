@@ -0,0 +1,59 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// 跟踪缓存中的一条指令(执行时解码, 不受之后修改内存的影响)
+type traceEntry struct {
+	PC   uint16
+	Code uint16
+	Ins  Instruction
+	OK   bool
+}
+
+// 记录即将执行的指令(TraceBuffer为0时不记录)
+func (p *Comet) traceRecord() {
+	if p.TraceBuffer <= 0 {
+		return
+	}
+	if len(p.trace) != p.TraceBuffer {
+		p.trace = make([]traceEntry, p.TraceBuffer)
+		p.traceNext, p.traceFull = 0, false
+	}
+
+	var e = traceEntry{PC: p.PC, Code: p.Mem[p.PC]}
+	if ins, ok := p.ParseInstruction(p.PC); ok {
+		e.Ins, e.OK = *ins, true
+	}
+
+	p.trace[p.traceNext] = e
+	if p.traceNext++; p.traceNext == len(p.trace) {
+		p.traceNext, p.traceFull = 0, true
+	}
+}
+
+// 格式化跟踪缓存中的指令(最早执行的在前)
+func (p *Comet) TraceDump() string {
+	var buf bytes.Buffer
+
+	var start, n = 0, p.traceNext
+	if p.traceFull {
+		start, n = p.traceNext, len(p.trace)
+	}
+	for i := 0; i < n; i++ {
+		e := &p.trace[(start+i)%len(p.trace)]
+		if e.OK {
+			fmt.Fprintf(&buf, "mem[%04x]: %v%s\n", e.PC, &e.Ins, p.noteSuffix(e.PC))
+		} else {
+			fmt.Fprintf(&buf, "mem[%04x]: 未知 (%04x)\n", e.PC, e.Code)
+		}
+	}
+
+	return buf.String()
+}
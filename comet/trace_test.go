@@ -0,0 +1,67 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTraceBuffer(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,1
+     LEA  GR1,2
+     LEA  GR1,3
+     LEA  GR2,4
+     DIV  GR1,Z
+     HALT
+Z    DC   0
+     END`)
+	p.TraceBuffer = 3
+	wantFault(t, p.Run(), FaultDivideByZero)
+
+	lines := strings.Split(strings.TrimSpace(p.TraceDump()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("跟踪缓存 %d 条, 期望 3:\n%s", len(lines), p.TraceDump())
+	}
+	for i, pc := range []string{"mem[0004]", "mem[0006]", "mem[0008]"} {
+		if !strings.HasPrefix(lines[i], pc) {
+			t.Fatalf("第 %d 条是 %q, 期望 %s", i, lines[i], pc)
+		}
+	}
+	if !strings.Contains(lines[2], "DIV") {
+		t.Fatalf("最后一条不是异常的指令: %q", lines[2])
+	}
+}
+
+func TestTraceFunc(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,2
+L    ST   GR1,X
+     LEA  GR1,-1,GR1
+     JNZ  L
+     HALT
+X    DC   9
+     END`)
+
+	var pcs []int
+	p.TraceFunc = func(pc int, instr int16, pre, post *VMState) {
+		pcs = append(pcs, pc)
+		if uint16(instr) != pre.Mem[pc] || pre.PC != uint16(pc) || post.InstrCount != pre.InstrCount+1 {
+			t.Errorf("%04x: instr = %04x, pre.PC = %04x, InstrCount %d -> %d", pc, uint16(instr), pre.PC, pre.InstrCount, post.InstrCount)
+		}
+		// ST之后才能看到写入的内存
+		if pc == 2 && (pre.Mem[9] == post.Mem[9] || post.Mem[9] != post.GR[1]) {
+			t.Errorf("ST: mem[0009] %d -> %d", pre.Mem[9], post.Mem[9])
+		}
+	}
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprintf("%x", pcs); s != "[0 2 4 6 2 4 6 8]" {
+		t.Fatalf("PC = %s, 期望 [0 2 4 6 2 4 6 8]", s)
+	}
+}
@@ -7,31 +7,144 @@ package comet
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"log"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
 	MEM_SIZE = 1 << 16 // 内存大小
 
 	SP_START = 0xFC00 // SP栈开始地址
+	SP_MIN   = 0xF000 // 栈区的最低地址(栈区为 SP_MIN ~ SP_START)
 	PC_START = 0x0000 // PC默认开始地址
 	PC_MAX   = 0xFC00 // PC最大地址
+
+	ZERO_PAGE_SIZE = 0x0002 // 默认的零页大小(START生成的入口跳转指令)
+	SUBROUTINE_MAX = 256    // dissub最多显示的指令数目
+
+	CONTEXT_CHECK_STEPS = 1024 // RunContext检查ctx的间隔(指令数目)
 )
 
 type Comet struct {
 	CPU
 	Stdin    *bufio.Reader              // 标准输入输出(VM自身使用)
 	Stdout   io.Writer                  // 标准输入输出(VM自身使用)
+	CharMap  CharMap                    // 字符IO的字符集(nil表示ASCII)
 	Shutdown bool                       // 已经关机
-	Syscall  func(ctx *Comet, id uint8) // 系统调用(GR0是返回值)
+	ExitCode int                        // 退出码(EXIT系统调用时GR0的值)
+	Syscall  func(ctx *Comet, id uint8) // 系统调用(GR0是返回值), 约定见SyscallError
+
+	// 每条指令执行之后调用(包括异常停机的指令), fault为本条指令产生的异常.
+	// 在跟踪缓存记录之后, 执行事件发送之前调用; 返回错误时异常停机.
+	PostStep func(p *Comet, ins Instruction, fault error) error
+
+	// StepRun每执行一条指令之后调用(nil表示关闭), 用于覆盖率统计和可视化.
+	// instr是指令的第一个字, pre和post是执行前后的快照(每步复制两次内存, 会明显变慢).
+	TraceFunc func(pc int, instr int16, pre, post *VMState)
+
+	InstrCount  int64 // 已执行的指令数目(不包括异常停机的指令)
+	Cycles      int64 // 时钟周期(每条指令1个周期, 加上缓存未命中的代价)
+	TraceBuffer int   // 保留最近执行的N条指令(0表示关闭), 用于tracedump
+
+	CheckBoundary bool   // 检查PC是否落在双字长指令的中间(操作数位置)
+	StrictEntry   bool   // 入口地址在载入的程序之外时异常停机(否则只输出警告)
+	CheckStackLD  bool   // LD读取栈区中SP之下(已经出栈)的数据时异常停机
+	RequireSPInit bool   // 程序没有设置GR4(SP)之前执行PUSH/CALL时异常停机
+	StackFloor    uint16 // PUSH/CALL使SP低于该地址时异常停机(默认为SP_MIN, 0表示不检查)
+	AutoFlush     bool   // 输出之后和停机时刷新Stdout(Stdout需要有Flush方法)
+	Profile       bool   // 统计各指令和各地址的执行次数(OpCountString, HotSpots)
+	HistorySize   int    // 反向单步(StepBack)保留的步数(0表示不记录)
+
+	RecordSyscalls bool // 记录执行的系统调用(SyscallLog)
+	RecordSteps    bool // 记录每一步的修改(StepLog), 用于ReplayFrom
+	OutputLimit    int  // 输出指令最多输出的字节数(0表示不限制), 超过时异常停机
+
+	MaxSteps int64       // 每次Run最多执行的指令数目(0表示不限制), 超过时返回ErrStepLimitExceeded
+	Clock    ClockSource // 时钟设备(读取IO_CLOCK)的计时方式
+
+	FlagBits bool // FR使用COMET-II的标志位(OF, SF, ZF), 否则FR保存最近一次运算的结果
+
+	WatchSnapshotLimit int // 保留的监视点快照数目(0表示WATCH_SNAPSHOT_MAX)
+
+	OverflowPolicy OverflowPolicy // 算术溢出(ADD, SUB, MUL, DIV)的处理方式
+	Overflow       bool           // 最近一次算术运算是否溢出(OverflowSetFlag时有效)
+
+	ZeroPageProtect bool   // 禁止写入零页(地址小于ZeroPageSize)
+	ZeroPageSize    uint16 // 零页大小
+
+	Cache   Cache       // 缓存模型(nil表示不使用)
+	CoreDir string      // 异常停机时保存core文件的目录(空表示不保存)
+	Source  SourceMap   // 源代码行映射(casl -map生成), 用于跟踪时显示源代码
+	Symbols SymbolTable // 标号表(casl -sym生成), 调试命令的地址参数可以使用标号
+
+	err      error             // 最近一次异常停机的原因
+	input    bytes.Buffer      // 排队的输入数据(优先于Stdin读取)
+	operands map[uint16]bool   // 已执行的双字长指令的操作数地址
+	events   chan Event        // 执行事件
+	entry    uint16            // 程序入口地址
+	progSize int               // 载入的程序大小(字数)
+	started  bool              // 已经开始执行(检查过入口地址)
+	notes    map[uint16]string // 地址的注释
+	data     [][2]uint16       // 标记为数据的区域[start, end)
+	mmio     []mmioRegion      // 映射到设备的区域
+
+	breakpoints map[uint16]bool   // 调试器的断点
+	watches     map[uint16]uint16 // 监视点(地址到最近的值)
+	watchHits   []WatchHit        // 最近触发的监视点
+	watchSnap   map[uint16]bool   // 触发时保存快照的监视点
+	watchSnaps  []WatchSnapshot   // 监视点触发时保存的快照
+
+	writeLogs  []*writeLog    // 写入地址的记录(RecordWrites)
+	syscallLog []SyscallEvent // 系统调用的记录(RecordSyscalls)
+	stepLog    []StepDelta    // 每一步的修改(RecordSteps)
+	stepCur    *StepDelta     // 正在执行的指令的修改
+
+	opCounts map[OpType]int64 // 各指令的执行次数(Profile)
+	pcCounts map[uint16]int64 // 各地址的执行次数(Profile)
+
+	syscallPC uint16 // 最近执行的系统调用指令的地址
+	syscallId uint8  // 最近执行的系统调用号
+
+	history  []historyRecord // 反向单步的历史记录(环形缓存)
+	histNext int             // 下一个记录的位置
+	histLen  int             // 有效的记录数目
+	histCur  *historyRecord  // 正在执行的指令的记录
+
+	outputBytes int  // 输出指令已经输出的字节数(OutputLimit)
+	outputOver  bool // 输出超过了OutputLimit
+
+	clockStart time.Time // 真实时钟的开始时间(ClockWall)
+
+	spInitialized bool   // 程序已经设置了GR4(SP)
+	spTop         uint16 // 栈顶的初始值(创建虚拟机、InitSP或栈为空时指令设置的SP), POP/RET不能超过
+	callDepth     int    // CALL/RET的嵌套层数
+	breakAt       int64  // 执行到该指令数目时Run暂停(0表示没有设置)
+
+	trace     []traceEntry // 最近执行的指令(环形缓存)
+	traceNext int          // 下一条记录的位置
+	traceFull bool         // 环形缓存已经写满
 }
 
+// 算术溢出的处理方式
+type OverflowPolicy int
+
+const (
+	OverflowSetFlag OverflowPolicy = iota // 设置Overflow标志, 继续执行(默认)
+	OverflowWrap                          // 按16位回绕, 不设置Overflow标志
+	OverflowFault                         // 异常停机
+)
+
 type CPU struct {
 	PC  uint16          // 指令计数器
 	FR  int16           // 标志寄存器
-	GR  [5]uint16       // 通用寄存器
+	GR  [5]uint16       // 通用寄存器(外部工具优先使用GetGR/SetGR, SP/SetSP)
 	Mem [1 << 16]uint16 // 64KB内存
 }
 
@@ -44,32 +157,205 @@ func (*stdReadWriter) Write(p []byte) (n int, err error) {
 	return os.Stdout.Write(p)
 }
 
-func NewComet(prog []uint16, pc int) *Comet {
+// 创建虚拟机, 程序从0地址载入, pc为入口地址
+// 栈指针GR4初始化为SP_START, 栈从SP_START向低地址增长
+// opts依次修改创建的虚拟机(比如WithRegisters, WithSP)
+func NewComet(prog []uint16, pc int, opts ...Option) *Comet {
 	p := new(Comet)
 	copy(p.Mem[:], prog)
 
 	p.PC = uint16(pc)
 	p.GR[4] = SP_START
+	p.spTop = SP_START
+	p.StackFloor = SP_MIN
+	p.entry = uint16(pc)
+	p.progSize = len(prog)
+	p.ZeroPageSize = ZERO_PAGE_SIZE
 
 	p.Stdin = bufio.NewReader(os.Stdin)
 	p.Stdout = os.Stdout
+	p.Syscall = Syscall
 
+	for _, opt := range opts {
+		opt(p)
+	}
 	return p
 }
 
-func (p *Comet) Run() {
-	if p.Shutdown {
-		return
+// 创建虚拟机并指定栈指针的初始值(RequireSPInit时视为已经初始化)
+func NewCometWithSP(prog []uint16, pc int, sp uint16) *Comet {
+	p := NewComet(prog, pc)
+	p.InitSP(sp)
+	return p
+}
+
+// 创建虚拟机的选项
+type Option func(p *Comet)
+
+// 设置GR0 ~ GR3的初始值, 用于测试从寄存器读取参数的子程序
+// gr[4](SP)为0时保持栈指针不变(默认为SP_START), 否则和WithSP相同
+func WithRegisters(gr [5]int16) Option {
+	return func(p *Comet) {
+		for i, v := range gr[:4] {
+			p.GR[i] = uint16(v)
+		}
+		if gr[4] != 0 {
+			p.SetSP(uint16(gr[4]))
+		}
+	}
+}
+
+// 设置栈指针的初始值(RequireSPInit时视为已经初始化)
+func WithSP(sp int16) Option {
+	return func(p *Comet) {
+		p.SetSP(uint16(sp))
 	}
-	for !p.Shutdown {
-		p.StepRun()
+}
+
+// 内存段(程序或数据)
+type Segment struct {
+	Addr uint16   // 开始地址
+	Data []uint16 // 数据
+}
+
+// 分段载入程序和数据(各段不能重叠)
+func NewSegmented(segments []Segment, pc int) (*Comet, error) {
+	var sorted = append([]Segment(nil), segments...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Addr < sorted[j].Addr
+	})
+
+	for i, seg := range sorted {
+		end := int(seg.Addr) + len(seg.Data)
+		if end > MEM_SIZE {
+			return nil, fmt.Errorf("内存段超出范围: %04x, 长度 %d", seg.Addr, len(seg.Data))
+		}
+		if i+1 < len(sorted) && end > int(sorted[i+1].Addr) {
+			return nil, fmt.Errorf("内存段重叠: %04x 和 %04x", seg.Addr, sorted[i+1].Addr)
+		}
 	}
+
+	p := NewComet(nil, pc)
+	for _, seg := range segments {
+		copy(p.Mem[seg.Addr:], seg.Data)
+		if end := int(seg.Addr) + len(seg.Data); end > p.progSize {
+			p.progSize = end
+		}
+	}
+	return p, nil
 }
 
-func (p *Comet) StepRun() {
+// 追加输入数据, 后续的输入指令优先读取排队的数据
+func (p *Comet) QueueInput(s string) {
+	p.input.WriteString(s)
+}
+
+// 输入指令读取数据的接口(记录反向单步的历史时同时记录读取的数据)
+func (p *Comet) stdin() io.Reader {
+	var r inputReader = p.Stdin
+	if p.input.Len() > 0 {
+		r = &p.input
+	}
+	if p.histCur != nil {
+		return &inputRecorder{r: r, rec: p.histCur}
+	}
+	return r
+}
+
+// 运行到停机(或者BreakAtStep设置的指令数目, 或者监视点被修改), 返回异常停机的原因
+//
+// 超过MaxSteps时返回ErrStepLimitExceeded, 没有停机, 寄存器保持不变, 可以继续Run.
+func (p *Comet) Run() error {
+	return p.RunContext(context.Background())
+}
+
+// 和Run相同, ctx取消(或超时)时暂停并返回ctx.Err(), 之后可以继续运行
+//
+// 每执行CONTEXT_CHECK_STEPS条指令检查一次ctx.
+func (p *Comet) RunContext(ctx context.Context) error {
 	if p.Shutdown {
+		return nil
+	}
+	for steps := int64(0); !p.Shutdown; steps++ {
+		if steps%CONTEXT_CHECK_STEPS == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		if p.breakAt > 0 && p.InstrCount >= p.breakAt {
+			p.breakAt = 0
+			return nil
+		}
+		if p.MaxSteps > 0 && steps >= p.MaxSteps {
+			return ErrStepLimitExceeded
+		}
+		// 只看本条指令触发的监视点(之前的记录可能还没有用WatchHits取走)
+		var hits = len(p.watchHits)
+		if err := p.StepRun(); err != nil {
+			return err
+		}
+		if len(p.watchHits) > hits {
+			return nil
+		}
+	}
+	return nil
+}
+
+// 指令计数, 时钟周期和指令统计(Profile)清零
+func (p *Comet) Reset() {
+	p.InstrCount = 0
+	p.Cycles = 0
+	p.opCounts, p.pcCounts = nil, nil
+}
+
+// 和Reset相同(以前的名字)
+func (p *Comet) ResetCount() {
+	p.Reset()
+}
+
+// 下次Run再执行n条指令之后暂停(没有停机, 可以继续Run), n <= 0 时取消
+func (p *Comet) BreakAtStep(n int) {
+	if n <= 0 {
+		p.breakAt = 0
 		return
 	}
+	p.breakAt = p.InstrCount + int64(n)
+}
+
+// 执行一条指令, 返回本条指令产生的异常(异常之后已经停机)
+func (p *Comet) StepRun() error {
+	if p.Shutdown {
+		return nil
+	}
+
+	var lastErr = p.err
+	var pc = p.PC
+	var pre *VMState
+	if p.TraceFunc != nil {
+		pre = p.Snapshot()
+	}
+	if p.HistorySize > 0 {
+		p.historyBegin()
+		defer p.historyEnd()
+	}
+	if p.RecordSteps {
+		p.stepBegin()
+		defer p.stepEnd()
+	}
+	p.step()
+	if p.watches != nil {
+		p.checkWatches(pc)
+	}
+	if pre != nil {
+		p.TraceFunc(int(pc), int16(pre.Mem[pc]), pre, p.Snapshot())
+	}
+	if p.err != lastErr {
+		return p.err
+	}
+	return nil
+}
+
+func (p *Comet) step() {
 
 	var op = OpType(p.Mem[p.PC] / 0x100)
 	var gr = (p.Mem[p.PC] % 0x100) / 0x10
@@ -77,157 +363,470 @@ func (p *Comet) StepRun() {
 	var adr = p.Mem[p.PC+1]
 	var syscalId = uint8(p.Mem[p.PC] % 0x100)
 
-	if gr < 0 || gr > 4 {
-		fmt.Printf("非法指令：mem[%x] = %x\n", p.PC, p.Mem[p.PC])
-		p.Shutdown = true
+	// 系统调用的低8位是调用号, 不含寄存器
+	if op == SYSCALL {
+		gr, xr = 0, 0
+	}
+
+	// 入口检查失败也要发送异常事件
+	if p.events != nil {
+		defer p.sendEvents(p.PC, op, syscalId, p.err)
+	}
+	if p.PostStep != nil {
+		defer p.postStep(p.PC, Instruction{
+			Op: op, GR: gr, XR: xr, ADR: p.Mem[p.PC+1], SyscallId: syscalId,
+		}, p.err)
+	}
+
+	if !p.started {
+		p.started = true
+		if !p.checkEntry() {
+			return
+		}
+	}
+
+	p.traceRecord()
+
+	if p.PC >= PC_MAX || op.Size() == 2 && p.PC+1 >= PC_MAX {
+		p.fault(FaultPCOutOfRange, "%w：PC = %x (最大 %x)", ErrPCOutOfRange, p.PC, PC_MAX)
 		return
 	}
-	if xr < 0 || xr > 4 {
-		fmt.Printf("非法指令：mem[%x] = %x\n", p.PC, p.Mem[p.PC])
-		p.Shutdown = true
+	if p.CheckBoundary && p.operands[p.PC] {
+		p.fault(FaultBadJump, "非法跳转：mem[%x] 是指令的操作数", p.PC)
+		return
+	}
+
+	if gr > 4 || xr > 4 {
+		p.fault(FaultBadRegister, "%w：mem[%x] = %x", ErrBadRegister, p.PC, p.Mem[p.PC])
 		return
 	}
+	if p.CheckBoundary && op.Size() == 2 {
+		if p.operands == nil {
+			p.operands = make(map[uint16]bool)
+		}
+		p.operands[p.PC+1] = true
+	}
 	if xr != 0 {
 		adr = uint16(int32(adr) + int32(p.GR[xr]))
 	}
 
 	// 临时: 处理IO
 	p.io()
+	if p.Shutdown || !p.checkOutput(p.PC) {
+		return
+	}
+
+	// 异常停机的指令不计数
+	defer func(pc uint16, err error) {
+		if p.err == err {
+			p.InstrCount++
+			if p.Profile {
+				p.profileRecord(pc, op)
+			}
+		}
+	}(p.PC, p.err)
+	p.Cycles++
+
+	if p.RequireSPInit && (op == PUSH || op == CALL) && !p.spInitialized {
+		p.fault(FaultStackUninitialized, "mem[%x]: %w", p.PC, ErrStackUninitialized)
+		return
+	}
+	if gr == 4 && op.WritesGR() {
+		p.spInitialized = true
+
+		// 栈为空时用指令设置SP(比如LEA GR4,...), 新的SP作为栈顶, POP/RET以它为界
+		// 栈中还有数据时(比如子程序预留局部变量)栈顶不变
+		if p.GR[4] == p.spTop {
+			defer func(err error) {
+				if p.err == err {
+					p.spTop = p.GR[4]
+				}
+			}(p.err)
+		}
+	}
 
 	// 指令解码
 	switch op {
 	case HALT:
 		p.PC += 1
 		p.Shutdown = true
+		p.flush()
 	case LD:
+		if p.CheckStackLD && adr >= SP_MIN && adr < p.spTop && adr < p.GR[4] {
+			p.fault(FaultStackRead, "非法读取：mem[%x] 位于栈顶(SP=%x)之下, 数据已经出栈", adr, p.GR[4])
+			return
+		}
 		p.PC += 2
-		p.GR[gr] = p.Mem[adr]
+		p.GR[gr] = p.readMem(adr)
 	case ST:
+		if !p.writeMem(adr, p.GR[gr]) {
+			return
+		}
 		p.PC += 2
-		p.Mem[adr] = p.GR[gr]
 	case LEA:
 		p.PC += 2
 		p.GR[gr] = adr
-		p.FR = int16(p.GR[gr])
+		p.setFR(int16(p.GR[gr]), false)
 	case ADD:
+		if !p.arith(gr, int32(int16(p.GR[gr]))+int32(int16(p.readMem(adr)))) {
+			return
+		}
 		p.PC += 2
-		p.GR[gr] = uint16(int16(p.GR[gr]) + int16(p.Mem[adr]))
-		p.FR = int16(p.GR[gr])
 	case SUB:
+		if !p.arith(gr, int32(int16(p.GR[gr]))-int32(int16(p.readMem(adr)))) {
+			return
+		}
 		p.PC += 2
-		p.GR[gr] = uint16(int16(p.GR[gr]) - int16(p.Mem[adr]))
-		p.FR = int16(p.GR[gr])
 	case MUL:
+		if !p.arith(gr, int32(int16(p.GR[gr]))*int32(int16(p.readMem(adr)))) {
+			return
+		}
 		p.PC += 2
-		p.GR[gr] = uint16(int16(p.GR[gr]) * int16(p.Mem[adr]))
-		p.FR = int16(p.GR[gr])
 	case DIV:
+		var d = p.readMem(adr)
+		if d == 0 {
+			p.fault(FaultDivideByZero, "%w：mem[%x]", ErrDivideByZero, p.PC)
+			return
+		}
+		if !p.arith(gr, int32(int16(p.GR[gr]))/int32(int16(d))) {
+			return
+		}
 		p.PC += 2
-		p.GR[gr] = uint16(int16(p.GR[gr]) / int16(p.Mem[adr]))
-		p.FR = int16(p.GR[gr])
 	case MOD:
+		var d = p.readMem(adr)
+		if d == 0 {
+			p.fault(FaultDivideByZero, "%w：mem[%x]", ErrDivideByZero, p.PC)
+			return
+		}
 		p.PC += 2
-		p.GR[gr] = uint16(int16(p.GR[gr]) % int16(p.Mem[adr]))
-		p.FR = int16(p.GR[gr])
+		p.GR[gr] = uint16(int16(p.GR[gr]) % int16(d))
+		p.setFR(int16(p.GR[gr]), false)
 	case AND:
 		p.PC += 2
-		p.GR[gr] &= p.Mem[adr]
-		p.FR = int16(p.GR[gr])
+		p.GR[gr] &= p.readMem(adr)
+		p.setFR(int16(p.GR[gr]), false)
 	case OR:
 		p.PC += 2
-		p.GR[gr] |= p.Mem[adr]
-		p.FR = int16(p.GR[gr])
+		p.GR[gr] |= p.readMem(adr)
+		p.setFR(int16(p.GR[gr]), false)
 	case EOR:
 		p.PC += 2
-		p.GR[gr] ^= p.Mem[adr]
-		p.FR = int16(p.GR[gr])
+		p.GR[gr] ^= p.readMem(adr)
+		p.setFR(int16(p.GR[gr]), false)
 	case SLA:
 		p.PC += 2
-		p.GR[gr] = uint16(int16(p.GR[gr]) << int16(p.Mem[adr]))
-		p.FR = int16(p.GR[gr])
+		p.GR[gr] = uint16(int16(p.GR[gr]) << p.readMem(adr))
+		p.setFR(int16(p.GR[gr]), false)
 	case SRA:
 		p.PC += 2
-		p.GR[gr] = uint16(int16(p.GR[gr]) >> int16(p.Mem[adr]))
-		p.FR = int16(p.GR[gr])
+		p.GR[gr] = uint16(int16(p.GR[gr]) >> p.readMem(adr))
+		p.setFR(int16(p.GR[gr]), false)
 	case SLL:
 		p.PC += 2
-		p.GR[gr] = p.GR[gr] << p.Mem[adr]
-		p.FR = int16(p.GR[gr])
+		p.GR[gr] = p.GR[gr] << p.readMem(adr)
+		p.setFR(int16(p.GR[gr]), false)
 	case SRL:
 		p.PC += 2
-		p.GR[gr] = p.GR[gr] >> p.Mem[adr]
-		p.FR = int16(p.GR[gr])
+		p.GR[gr] = p.GR[gr] >> p.readMem(adr)
+		p.setFR(int16(p.GR[gr]), false)
 	case CPA:
 		p.PC += 2
-		p.FR = int16(p.GR[gr]) - int16(p.Mem[adr])
+		var a, b = int16(p.GR[gr]), int16(p.readMem(adr))
+		p.setCompareFR(int32(a)-int32(b), a-b)
 	case CPL:
 		p.PC += 2
-		p.FR = int16(p.GR[gr] - p.Mem[adr])
+		var a, b = p.GR[gr], p.readMem(adr)
+		p.setCompareFR(int32(a)-int32(b), int16(a-b))
 	case JMP:
 		p.PC += 2
 		p.PC = adr
 	case JPZ:
 		p.PC += 2
-		if p.FR >= 0 {
+		if !p.flagSign() {
 			p.PC = adr
 		}
 	case JMI:
 		p.PC += 2
-		if p.FR < 0 {
+		if p.flagSign() {
 			p.PC = adr
 		}
 	case JNZ:
 		p.PC += 2
-		if p.FR != 0 {
+		if !p.flagZero() {
 			p.PC = adr
 		}
 	case JZE:
 		p.PC += 2
-		if p.FR == 0 {
+		if p.flagZero() {
 			p.PC = adr
 		}
 	case PUSH:
+		if p.GR[4] == 0 {
+			p.fault(FaultStackUninitialized, "mem[%x]: %w", p.PC, ErrStackUninitialized)
+			return
+		}
+		if !p.checkPush() {
+			return
+		}
+		if !p.writeMem(p.GR[4]-1, p.readMem(adr)) {
+			return
+		}
 		p.PC += 2
-		p.Mem[p.GR[4]-1] = p.Mem[adr]
 		p.GR[4]--
 	case POP:
+		if !p.checkPop() {
+			return
+		}
 		p.PC += 1
-		p.GR[gr] = p.Mem[p.GR[4]]
+		p.GR[gr] = p.readMem(p.GR[4])
 		p.GR[4]++
 	case CALL:
-		p.PC += 2
-		p.Mem[p.GR[4]-1] = p.PC
-		p.PC = p.Mem[adr]
+		if p.GR[4] == 0 {
+			p.fault(FaultStackUninitialized, "mem[%x]: %w", p.PC, ErrStackUninitialized)
+			return
+		}
+		if !p.checkPush() {
+			return
+		}
+		if !p.writeMem(p.GR[4]-1, p.PC+2) {
+			return
+		}
+		p.PC = p.readMem(adr)
 		p.GR[4]--
+		p.callDepth++
 	case RET:
+		if !p.checkPop() {
+			return
+		}
 		p.PC += 1
-		p.PC = p.Mem[p.GR[4]]
+		p.PC = p.readMem(p.GR[4])
 		p.GR[4]++
+		if p.callDepth > 0 {
+			p.callDepth--
+		}
+
+	case LDB:
+		p.PC += 2
+		p.GR[gr] = p.readByte(adr)
+	case LDBS:
+		p.PC += 2
+		p.GR[gr] = uint16(int8(p.readByte(adr)))
+	case STB:
+		if !p.writeByte(adr, p.GR[gr]) {
+			return
+		}
+		p.PC += 2
+
+	case CLR:
+		p.PC += 1
+		p.GR[gr] = 0
+		p.setFR(0, false)
+	case CMOVZ:
+		var v = p.readMem(adr)
+		p.PC += 2
+		if p.flagZero() {
+			p.GR[gr] = v
+		}
+	case TEST:
+		p.PC += 2
+		p.setFR(int16(p.GR[gr]&p.readMem(adr)), false)
+	case ADDL:
+		var a, b = p.GR[gr], p.readMem(adr)
+		p.PC += 2
+		p.GR[gr] = a + b
+		p.setFR(int16(a+b), uint32(a)+uint32(b) > 0xFFFF)
+	case SUBL:
+		var a, b = p.GR[gr], p.readMem(adr)
+		p.PC += 2
+		p.GR[gr] = a - b
+		p.setFR(int16(a-b), b > a)
 
 	case SYSCALL:
+		if p.Syscall == nil {
+			p.fault(FaultIllegalInstruction, "%w：mem[%x] = %x 没有设置系统调用函数", ErrIllegalInstruction, p.PC, p.Mem[p.PC])
+			return
+		}
+		if p.RecordSyscalls {
+			p.logSyscall(p.PC, syscalId)
+		}
+		var pc = p.PC
+		p.syscallPC, p.syscallId = pc, syscalId
 		p.PC += 1
 		p.Syscall(p, syscalId)
+		if !p.Shutdown {
+			p.checkOutput(pc)
+		}
 
 	default:
-		p.Shutdown = true
-		fmt.Printf("非法指令：mem[%x] = %x\n", p.PC, p.Mem[p.PC])
+		p.fault(FaultIllegalInstruction, "%w：mem[%x] = %x", ErrIllegalInstruction, p.PC, p.Mem[p.PC])
+	}
+}
+
+// 检查入口地址是否在载入的程序之内(一般是程序或入口地址错误)
+func (p *Comet) checkEntry() bool {
+	if p.progSize == 0 || p.PC != p.entry || int(p.entry) < p.progSize {
+		return true
+	}
+	if p.StrictEntry {
+		p.fault(FaultBadEntry, "入口地址 %x 超出程序范围(程序大小 %d)", p.entry, p.progSize)
+		return false
 	}
+	log.Printf("COMET: 警告: 入口地址 %x 超出程序范围(程序大小 %d)\n", p.entry, p.progSize)
+	return true
+}
+
+// 调用PostStep(lastErr为执行前的错误)
+func (p *Comet) postStep(pc uint16, ins Instruction, lastErr error) {
+	var fault error
+	if p.err != lastErr {
+		fault = p.err
+	}
+	if err := p.PostStep(p, ins, fault); err != nil && fault == nil {
+		p.faultAt(pc, FaultPostStep, "mem[%x]: %w", pc, err)
+	}
+}
+
+// 重置寄存器和停机状态(内存保持不变), 从pc位置重新运行
+// GR4(SP)恢复为栈顶的初始值(新建虚拟机或InitSP时的SP)
+func (p *Comet) ResetRegs(pc int) {
+	p.PC = uint16(pc)
+	p.FR = 0
+	p.GR = [5]uint16{4: p.spTop}
+
+	p.Shutdown = false
+	p.ExitCode = 0
+	p.Overflow = false
+	p.err = nil
+	p.spInitialized = false
+	p.outputBytes = 0
+	p.callDepth = 0
+}
+
+// 从pc位置执行一条指令(忽略当前的PC), 返回执行时出现的错误
+// 执行前会清除停机状态, 之后可以继续运行
+func (p *Comet) ExecAt(pc int) error {
+	if pc < 0 || pc >= MEM_SIZE {
+		return fmt.Errorf("无效的地址：%x", pc)
+	}
+
+	p.PC = uint16(pc)
+	p.Shutdown = false
+	p.err = nil
+
+	return p.StepRun()
+}
+
+// 保存算术运算的结果, 按OverflowPolicy处理溢出(异常停机时返回false)
+func (p *Comet) arith(gr uint16, v int32) bool {
+	var overflow = v != int32(int16(v))
+
+	switch p.OverflowPolicy {
+	case OverflowSetFlag:
+		p.Overflow = overflow
+	case OverflowFault:
+		if overflow {
+			p.fault(FaultOverflow, "算术溢出：mem[%x] 结果为 %d", p.PC, v)
+			return false
+		}
+	}
+
+	p.GR[gr] = uint16(v)
+	p.setFR(int16(v), overflow)
+	return true
+}
+
+// 由宿主程序设置栈指针(RequireSPInit时视为已经初始化), sp同时作为栈顶(POP/RET的上限)
+func (p *Comet) InitSP(sp uint16) {
+	p.GR[4] = sp
+	p.spTop = sp
+	p.spInitialized = true
+}
+
+// 读内存(经过缓存模型), 时钟设备不经过缓存
+func (p *Comet) readMem(adr uint16) uint16 {
+	if v, ok := p.mmioAccess(adr, false, 0); ok {
+		return v
+	}
+	if adr == IO_CLOCK && p.Clock != ClockNone {
+		return p.clockTicks()
+	}
+	if p.Cache != nil {
+		p.Cycles += int64(p.Cache.Access(adr, false))
+	}
+	return p.Mem[adr]
+}
+
+// 写内存(检查零页保护, 经过缓存模型)
+func (p *Comet) writeMem(adr, v uint16) bool {
+	if p.ZeroPageProtect && adr < p.ZeroPageSize {
+		p.fault(FaultZeroPage, "非法写入：mem[%x] 位于零页(小于%x)", adr, p.ZeroPageSize)
+		return false
+	}
+	if _, ok := p.mmioAccess(adr, true, v); ok {
+		return true
+	}
+	if p.Cache != nil {
+		p.Cycles += int64(p.Cache.Access(adr, true))
+	}
+	if p.writeLogs != nil {
+		p.logWrite(adr)
+	}
+	if p.histCur != nil {
+		p.histCur.mem = append(p.histCur.mem, memDelta{adr, p.Mem[adr]})
+	}
+	if p.stepCur != nil {
+		p.logStepWrite(adr, v)
+	}
+	p.Mem[adr] = v
+	return true
+}
+
+// 读字节(adr为字节地址, 偶数对应高8位, 奇数对应低8位)
+func (p *Comet) readByte(adr uint16) uint16 {
+	if adr%2 == 0 {
+		return p.readMem(adr/2) >> 8
+	}
+	return p.readMem(adr/2) & 0xFF
+}
+
+// 写字节(adr为字节地址, 只写入v的低8位)
+func (p *Comet) writeByte(adr, v uint16) bool {
+	var w = p.Mem[adr/2]
+	if adr%2 == 0 {
+		w = w&0x00FF | v<<8
+	} else {
+		w = w&0xFF00 | v&0x00FF
+	}
+	return p.writeMem(adr/2, w)
 }
 
 func (p *Comet) DebugRun() {
+	if p.HistorySize == 0 {
+		p.HistorySize = HISTORY_SIZE
+	}
+
 	var (
 		backup  = *p
 		stepcnt int
 		pntflag bool
 		traflag bool
+		srcflag bool
+		radix   = 16
+		sess    = &debugSession{track: -1, display: 16}
 	)
 
-	fmt.Println("调试 （帮助输入 help）...")
-	fmt.Println()
+	fmt.Fprintln(p.Stdout, "调试 （帮助输入 help）...")
+	fmt.Fprintln(p.Stdout)
 
 	for {
-		fmt.Print("输入命令: ")
-		line, _, _ := p.Stdin.ReadLine()
+		fmt.Fprint(p.Stdout, "输入命令: ")
+		line, _, err := p.Stdin.ReadLine()
+		if err != nil {
+			// 输入结束(比如管道输入的命令已经读完), 等同于quit
+			fmt.Fprintln(p.Stdout)
+			fmt.Fprintln(p.Stdout, "退出调试...")
+			return
+		}
 
 		// 删除空白字符
 		line = bytes.TrimSpace(line)
@@ -238,34 +837,47 @@ func (p *Comet) DebugRun() {
 			continue
 		}
 
-		var cmd, x1, x2 = "", 0, 0
-		n, _ := fmt.Fscanf(bytes.NewBuffer(line), "%s%x%x", &cmd, &x1, &x2)
+		cmd, x1, x2, x3, n := scanCommand(string(line), radix, p.Symbols)
 
 		switch cmd {
 		case "help", "h":
-			fmt.Println(p.DebugHelp())
+			fmt.Fprintln(p.Stdout, p.DebugHelp())
 		case "go", "g":
 			if p.Shutdown {
-				fmt.Println("已经停机, 输入 `clear` 指令重置机器")
+				fmt.Fprintln(p.Stdout, "已经停机, 输入 `clear` 指令重置机器")
 				continue
 			}
+			var hits, skip = 0, 1
+			if n >= 2 && x1 > 1 {
+				skip = x1
+			}
 			stepcnt = 0
 			for !p.Shutdown {
 				stepcnt++
 				if traflag {
-					fmt.Print(p.FormatInstruction(p.PC, 1))
+					fmt.Fprint(p.Stdout, p.formatTrace(p.PC, srcflag))
 				}
 
 				// 单步执行(可能执行HALT关机指令)
-				p.StepRun()
+				if !p.debugStep(sess) {
+					break
+				}
+				if p.breakpoints[p.PC] && !p.Shutdown {
+					if hits++; hits < skip {
+						fmt.Fprintf(p.Stdout, "断点 %04x (第 %d 次, 继续运行)\n", p.PC, hits)
+						continue
+					}
+					fmt.Fprintf(p.Stdout, "断点 %04x\n", p.PC)
+					break
+				}
 			}
 			if pntflag {
-				fmt.Printf("执行指令数目 = %d\n", stepcnt)
+				fmt.Fprintf(p.Stdout, "执行指令数目 = %d (累计 %d, 时钟周期 %d)\n", stepcnt, p.InstrCount, p.Cycles)
 			}
 
 		case "step", "s":
 			if p.Shutdown {
-				fmt.Println("已经停机, 输入 `clear` 指令重置机器")
+				fmt.Fprintln(p.Stdout, "已经停机, 输入 `clear` 指令重置机器")
 				continue
 			}
 
@@ -278,47 +890,127 @@ func (p *Comet) DebugRun() {
 			var i int
 			for i = 0; i < stepcnt && !p.Shutdown; i++ {
 				if traflag {
-					fmt.Print(p.FormatInstruction(p.PC, 1))
+					fmt.Fprint(p.Stdout, p.formatTrace(p.PC, srcflag))
 				}
 
 				// 单步执行(可能执行HALT关机指令)
-				p.StepRun()
+				if !p.debugStep(sess) {
+					i++
+					break
+				}
 			}
 			if pntflag {
-				fmt.Printf("执行指令数目 = %d\n", i)
+				fmt.Fprintf(p.Stdout, "执行指令数目 = %d (累计 %d, 时钟周期 %d)\n", i, p.InstrCount, p.Cycles)
 			}
 
+		case "stepflag":
+			if p.Shutdown {
+				fmt.Fprintln(p.Stdout, "已经停机, 输入 `clear` 指令重置机器")
+				continue
+			}
+
+			// 最多执行 x1 条指令(没有参数时不限制)
+			var i int
+			for i = 0; (n < 2 || i < x1) && !p.Shutdown; i++ {
+				var pc, fr = p.PC, p.FR
+				if traflag {
+					fmt.Fprint(p.Stdout, p.formatTrace(p.PC, srcflag))
+				}
+				if !p.debugStep(sess) {
+					i++
+					break
+				}
+				if p.FR != fr {
+					i++
+					fmt.Fprintf(p.Stdout, "mem[%04x] 修改了FR: %04x -> %04x\n", pc, uint16(fr), uint16(p.FR))
+					break
+				}
+			}
+			if pntflag {
+				fmt.Fprintf(p.Stdout, "执行指令数目 = %d (累计 %d, 时钟周期 %d)\n", i, p.InstrCount, p.Cycles)
+			}
+
+		case "back", "b":
+			if n >= 2 {
+				stepcnt = x1
+			} else {
+				stepcnt = 1
+			}
+
+			var i int
+			for i = 0; i < stepcnt; i++ {
+				kept, err := p.stepBack()
+				if err != nil {
+					fmt.Fprintln(p.Stdout, "错误:", err)
+					break
+				}
+				if len(kept) > 0 {
+					fmt.Fprintf(p.Stdout, "注意: mem[%04x] 的输出 %q 已经显示, 不能撤销\n", p.PC, kept)
+				}
+			}
+			fmt.Fprintf(p.Stdout, "回退 %d 条指令 (PC = %04x)\n", i, p.PC)
+
 		case "jump", "j":
 			if n >= 2 {
-				fmt.Printf("指令跳转到 %x\n", x1)
+				fmt.Fprintf(p.Stdout, "指令跳转到 %x\n", x1)
 				p.PC = uint16(x1)
 			} else {
-				fmt.Println("错误: 缺少跳转地址")
+				fmt.Fprintln(p.Stdout, "错误: 缺少跳转地址")
 			}
 
 		case "regs", "r":
-			fmt.Println("显示寄存器数据")
+			fmt.Fprintln(p.Stdout, "显示寄存器数据")
 
+			var fr string
 			switch {
+			case p.FlagBits:
+				fr = p.flagString() + " (OF SF ZF)"
 			case p.FR > 0:
-				fmt.Printf("GR[0] = %04x\tPC = %04x\n", p.GR[0], p.PC)
-				fmt.Printf("GR[1] = %04x\tSP = %04x\n", p.GR[1], uint16(p.GR[4]))
-				fmt.Printf("GR[2] = %04x\tFR = ..00\n", p.GR[2])
-				fmt.Printf("GR[3] = %04x\n", p.GR[3])
+				fr = "..00"
 			case p.FR < 0:
-				fmt.Printf("GR[0] = %04x\tPC = %04x\n", p.GR[0], p.PC)
-				fmt.Printf("GR[1] = %04x\tSP = %04x\n", p.GR[1], uint16(p.GR[4]))
-				fmt.Printf("GR[2] = %04x\tFR = ..10\n", p.GR[2])
-				fmt.Printf("GR[3] = %04x\n", p.GR[3])
+				fr = "..10"
 			default:
-				fmt.Printf("GR[0] = %04x\tPC = %04x\n", p.GR[0], p.PC)
-				fmt.Printf("GR[1] = %04x\tSP = %04x\n", p.GR[1], uint16(p.GR[4]))
-				fmt.Printf("GR[2] = %04x\tFR = ..01\n", p.GR[2])
-				fmt.Printf("GR[3] = %04x\n", p.GR[3])
+				fr = "..01"
+			}
+			var gr [4]uint16
+			for i := range gr {
+				v, _ := p.GetGR(i)
+				gr[i] = uint16(v)
 			}
+			var d = sess.display
+			fmt.Fprintf(p.Stdout, "GR[0] = %s\tPC = %04x\n", formatWord(gr[0], d), p.PC)
+			fmt.Fprintf(p.Stdout, "GR[1] = %s\tSP = %04x\n", formatWord(gr[1], d), p.SP())
+			fmt.Fprintf(p.Stdout, "GR[2] = %s\tFR = %s\n", formatWord(gr[2], d), fr)
+			fmt.Fprintf(p.Stdout, "GR[3] = %s\n", formatWord(gr[3], d))
+
+		case "setreg":
+			args := strings.Fields(string(line[len(cmd):]))
+			if len(args) != 2 {
+				fmt.Fprintln(p.Stdout, "错误: 需要寄存器和数值, 比如 setreg GR1 10")
+				continue
+			}
+			v, err := strconv.ParseInt(args[1], radix, 32)
+			if err != nil || v < -0x8000 || v > 0xFFFF {
+				fmt.Fprintln(p.Stdout, "错误: 无效的数值", args[1])
+				continue
+			}
+			if strings.ToUpper(args[0]) == "SP" {
+				p.SetSP(uint16(v))
+				fmt.Fprintf(p.Stdout, "修改寄存器 SP = %04x\n", p.SP())
+				continue
+			}
+			gr, err := parseGR(args[0])
+			if err == nil {
+				err = p.SetGR(int(gr), int16(v))
+			}
+			if err != nil {
+				fmt.Fprintln(p.Stdout, "错误:", err)
+				continue
+			}
+			fmt.Fprintf(p.Stdout, "修改寄存器 GR%d = %04x\n", gr, uint16(v))
 
 		case "iMem", "imem", "i":
-			fmt.Println("显示内存指令")
+			fmt.Fprintln(p.Stdout, "显示内存指令")
 
 			x1 := uint16(x1)
 			if n < 2 {
@@ -328,7 +1020,7 @@ func (p *Comet) DebugRun() {
 				x2 = 1
 			}
 
-			fmt.Print(p.FormatInstruction(x1, x2))
+			fmt.Fprint(p.Stdout, p.FormatInstruction(x1, x2))
 
 		case "dMem", "dmem", "d":
 			x1 := uint16(x1)
@@ -340,78 +1032,469 @@ func (p *Comet) DebugRun() {
 			}
 
 			for i := 0; i < x2 && i < len(p.Mem); i++ {
-				fmt.Printf("mem[%04x] = %04x\n", x1, uint16(p.Mem[x1]))
+				fmt.Fprintf(p.Stdout, "mem[%04x] = %s%s\n", x1, formatWord(p.Mem[x1], sess.display), p.noteSuffix(x1))
 				x1++
 			}
 
+		case "in":
+			s, err := strconv.Unquote(string(bytes.TrimSpace(line[len(cmd):])))
+			if err != nil {
+				fmt.Fprintln(p.Stdout, "错误: 输入数据需要用双引号包含")
+				continue
+			}
+			p.QueueInput(s)
+			fmt.Fprintf(p.Stdout, "输入数据排队 %q\n", s)
+
+		case "dissub":
+			if n < 2 {
+				fmt.Fprintln(p.Stdout, "错误: 缺少子程序地址")
+				continue
+			}
+			fmt.Fprint(p.Stdout, p.FormatSubroutine(uint16(x1)))
+
+		case "note":
+			if n < 2 {
+				fmt.Fprintln(p.Stdout, "错误: 缺少地址")
+				continue
+			}
+			var text string
+			if args := strings.Fields(string(line[len(cmd):])); len(args) > 1 {
+				rest := strings.TrimSpace(string(line[len(cmd):]))
+				rest = strings.TrimSpace(rest[len(args[0]):])
+				s, err := strconv.Unquote(rest)
+				if err != nil {
+					fmt.Fprintln(p.Stdout, "错误: 注释需要用双引号包含")
+					continue
+				}
+				text = s
+			}
+			p.SetNote(uint16(x1), text)
+			if text == "" {
+				fmt.Fprintf(p.Stdout, "删除 mem[%04x] 的注释\n", x1)
+			} else {
+				fmt.Fprintf(p.Stdout, "mem[%04x] 注释为 %q\n", x1, text)
+			}
+
+		case "track":
+			arg := strings.TrimSpace(string(line[len(cmd):]))
+			if arg == "" || arg == "off" {
+				sess.track = -1
+				fmt.Fprintln(p.Stdout, "寄存器跟踪功能 关闭")
+				continue
+			}
+			gr, err := parseGR(arg)
+			if err != nil {
+				fmt.Fprintln(p.Stdout, "错误:", err)
+				continue
+			}
+			sess.track = int(gr)
+			fmt.Fprintf(p.Stdout, "跟踪读写 GR%d 的指令\n", gr)
+
+		case "frames":
+			args := strings.Fields(string(line[len(cmd):]))
+			if len(args) == 0 || args[0] == "off" {
+				if sess.frames != nil {
+					fmt.Fprintf(p.Stdout, "停止保存帧, 共保存 %d 帧\n", sess.frames.n)
+				}
+				sess.frames = nil
+				continue
+			}
+			sess.frames = &frameRecorder{dir: args[0], limit: FRAME_LIMIT}
+			if len(args) > 1 {
+				limit, err := strconv.Atoi(args[1])
+				if err != nil || limit <= 0 {
+					fmt.Fprintln(p.Stdout, "错误: 无效的帧数", args[1])
+					sess.frames = nil
+					continue
+				}
+				sess.frames.limit = limit
+			}
+			fmt.Fprintf(p.Stdout, "每步执行之后保存寄存器状态到 %s （最多 %d 帧）\n", sess.frames.dir, sess.frames.limit)
+
+		case "savelst":
+			filename := string(bytes.TrimSpace(line[len(cmd):]))
+			if filename == "" {
+				fmt.Fprintln(p.Stdout, "错误: 缺少文件名")
+				continue
+			}
+			if err := p.SaveListing(filename); err != nil {
+				fmt.Fprintln(p.Stdout, "错误:", err)
+				continue
+			}
+			fmt.Fprintf(p.Stdout, "程序列表保存到 %s\n", filename)
+
+		case "tos":
+			if n < 2 {
+				x1 = 1
+			}
+
+			sp := int(p.GR[4])
+			if sp >= int(p.spTop) {
+				fmt.Fprintln(p.Stdout, "栈为空")
+				continue
+			}
+			for i := 0; i < x1 && sp+i < int(p.spTop); i++ {
+				fmt.Fprintf(p.Stdout, "mem[%04x] = %04x\n", sp+i, p.Mem[sp+i])
+			}
+
+		case "cmpmem":
+			if n < 4 || x1 < 0 || x2 < 0 || x1 >= MEM_SIZE || x2 >= MEM_SIZE || x3 <= 0 {
+				fmt.Fprintln(p.Stdout, "错误: 需要两个地址和比较的字数")
+				continue
+			}
+
+			fmt.Fprintf(p.Stdout, "比较 mem[%04x] 和 mem[%04x] 开始的 %d 个数据\n", x1, x2, x3)
+			if memOverlap(uint16(x1), uint16(x2), x3) {
+				fmt.Fprintln(p.Stdout, "注意: 两个区域重叠")
+			}
+			diffs := p.CompareMem(uint16(x1), uint16(x2), x3)
+			for _, d := range diffs {
+				fmt.Fprintf(p.Stdout, "mem[%04x] = %04x\tmem[%04x] = %04x\n", x1+d.Offset, d.A, x2+d.Offset, d.B)
+			}
+			if len(diffs) == 0 {
+				fmt.Fprintln(p.Stdout, "没有不同")
+			} else {
+				fmt.Fprintf(p.Stdout, "共 %d 处不同\n", len(diffs))
+			}
+
 		case "alter", "a":
 			if n == 3 {
-				fmt.Printf("修改内存数据  mem[%x] = %x\n", x1, x2)
+				fmt.Fprintf(p.Stdout, "修改内存数据  mem[%x] = %x\n", x1, x2)
 				p.Mem[x1] = uint16(x2)
+				p.checkWatches(p.PC)
+				for _, h := range p.WatchHits() {
+					fmt.Fprintf(p.Stdout, "监视点 mem[%04x] 被 alter 修改: %04x -> %04x\n", h.Addr, h.Old, h.New)
+				}
 			} else {
-				fmt.Println("修改内存数据 失败！")
+				fmt.Fprintln(p.Stdout, "修改内存数据 失败！")
 			}
 
+		case "teach":
+			p.teach()
+
 		case "trace", "t":
+			if strings.TrimSpace(string(line[len(cmd):])) == "src" {
+				if p.Source == nil {
+					fmt.Fprintln(p.Stdout, "错误: 没有载入源代码行映射")
+					continue
+				}
+				srcflag = !srcflag
+				fmt.Fprintf(p.Stdout, "指令显示源代码 %s\n", onOff(srcflag))
+				continue
+			}
 			traflag = !traflag
 			if traflag {
-				fmt.Println("指令显示功能 打开")
+				fmt.Fprintln(p.Stdout, "指令显示功能 打开")
+			} else {
+				fmt.Fprintln(p.Stdout, "指令显示功能 关闭")
+			}
+
+		case "tracedump":
+			if p.TraceBuffer <= 0 {
+				fmt.Fprintln(p.Stdout, "跟踪缓存未打开")
+				continue
+			}
+			fmt.Fprintf(p.Stdout, "最近执行的指令 （最多 %d 条）\n", p.TraceBuffer)
+			fmt.Fprint(p.Stdout, p.TraceDump())
+
+		case "radix":
+			switch strings.TrimSpace(string(line[len(cmd):])) {
+			case "hex":
+				radix = 16
+			case "dec":
+				radix = 10
+			default:
+				fmt.Fprintln(p.Stdout, "错误: 参数为 hex 或 dec")
+				continue
+			}
+			fmt.Fprintf(p.Stdout, "命令参数的进制为 %d\n", radix)
+
+		case "display":
+			switch strings.TrimSpace(string(line[len(cmd):])) {
+			case "hex":
+				sess.display = 16
+			case "dec":
+				sess.display = 10
+			case "bin":
+				sess.display = 2
+			default:
+				fmt.Fprintln(p.Stdout, "错误: 参数为 hex, dec 或 bin")
+				continue
+			}
+			fmt.Fprintf(p.Stdout, "regs 和 dMem 按 %d 进制显示数据\n", sess.display)
+
+		case "break":
+			if n < 2 {
+				fmt.Fprintln(p.Stdout, "错误: 缺少断点地址")
+				continue
+			}
+			p.SetBreakpoint(uint16(x1))
+			fmt.Fprintf(p.Stdout, "设置断点 %04x\n", uint16(x1))
+
+		case "watch":
+			if n < 2 {
+				for _, adr := range p.Watches() {
+					fmt.Fprintf(p.Stdout, "监视点 mem[%04x] = %04x\n", adr, p.Mem[adr])
+				}
+				continue
+			}
+			p.SetWatch(x1)
+			fmt.Fprintf(p.Stdout, "设置监视点 mem[%04x]\n", uint16(x1))
+
+		case "unwatch":
+			if n < 2 || !p.ClearWatch(x1) {
+				fmt.Fprintln(p.Stdout, "错误: 没有该监视点")
+				continue
+			}
+			fmt.Fprintf(p.Stdout, "删除监视点 mem[%04x]\n", uint16(x1))
+
+		case "delete":
+			if n < 2 {
+				for _, adr := range p.Breakpoints() {
+					p.ClearBreakpoint(adr)
+				}
+				fmt.Fprintln(p.Stdout, "删除全部断点")
+			} else if p.ClearBreakpoint(uint16(x1)) {
+				fmt.Fprintf(p.Stdout, "删除断点 %04x\n", uint16(x1))
 			} else {
-				fmt.Println("指令显示功能 关闭")
+				fmt.Fprintf(p.Stdout, "错误: %04x 没有断点\n", uint16(x1))
+			}
+
+		case "info":
+			if strings.TrimSpace(string(line[len(cmd):])) == "break" {
+				if len(p.breakpoints) == 0 {
+					fmt.Fprintln(p.Stdout, "没有断点")
+				}
+				for _, adr := range p.Breakpoints() {
+					fmt.Fprintf(p.Stdout, "断点 %04x%s\n", adr, p.noteSuffix(adr))
+				}
+				continue
+			}
+			fmt.Fprintf(p.Stdout, "命令参数的进制为 %d\n", radix)
+			fmt.Fprintf(p.Stdout, "指令显示功能 %s\n", onOff(traflag))
+			fmt.Fprintf(p.Stdout, "指令计数功能 %s\n", onOff(pntflag))
+			fmt.Fprintf(p.Stdout, "跟踪缓存大小 %d\n", p.TraceBuffer)
+			if sess.track >= 0 {
+				fmt.Fprintf(p.Stdout, "跟踪寄存器 GR%d\n", sess.track)
+			}
+			if len(sess.asserts) == 0 {
+				fmt.Fprintln(p.Stdout, "断言(违反时停止) 无")
+			}
+			for i, a := range sess.asserts {
+				fmt.Fprintf(p.Stdout, "断言(违反时停止) %d: %v\n", i+1, a)
+			}
+
+		case "assert":
+			arg := strings.TrimSpace(string(line[len(cmd):]))
+			switch arg {
+			case "":
+				for i, a := range sess.asserts {
+					fmt.Fprintf(p.Stdout, "断言 %d: %v\n", i+1, a)
+				}
+			case "clear":
+				sess.asserts = nil
+				fmt.Fprintln(p.Stdout, "删除全部断言")
+			default:
+				a, err := parseAssert(arg, radix)
+				if err != nil {
+					fmt.Fprintln(p.Stdout, "错误:", err)
+					continue
+				}
+				sess.asserts = append(sess.asserts, a)
+				fmt.Fprintf(p.Stdout, "增加断言 %d: %v\n", len(sess.asserts), a)
 			}
 
 		case "print", "p":
 			pntflag = !pntflag
 			if pntflag {
-				fmt.Println("指令计数功能 打开")
+				fmt.Fprintln(p.Stdout, "指令计数功能 打开")
 			} else {
-				fmt.Println("指令计数功能 关闭")
+				fmt.Fprintln(p.Stdout, "指令计数功能 关闭")
 			}
 
+		case "depth":
+			var words = 0
+			if p.SP() < p.spTop {
+				words = int(p.spTop) - int(p.SP())
+			}
+			fmt.Fprintf(p.Stdout, "调用深度 = %d （栈中共有 %d 个数据）\n", p.CallDepth(), words)
+
+		case "resetcount":
+			fmt.Fprintln(p.Stdout, "指令计数清零")
+			p.Reset()
+
+		case "rreset":
+			if n < 2 {
+				x1 = int(backup.PC)
+			}
+			p.ResetRegs(x1)
+			fmt.Fprintf(p.Stdout, "寄存器重置, 内存保持不变 (PC = %04x)\n", uint16(x1))
+
 		case "clear", "c":
-			fmt.Println("程序重新载入内存")
+			fmt.Fprintln(p.Stdout, "程序重新载入内存")
+			notes, breakpoints, watches := p.notes, p.breakpoints, p.Watches()
 			*p = backup
+			p.notes, p.breakpoints = notes, breakpoints
+			p.watches = nil
+			for _, adr := range watches {
+				p.SetWatch(int(adr))
+			}
 			stepcnt = 0
 
 		case "quit", "q":
-			fmt.Println("退出调试...")
+			fmt.Fprintln(p.Stdout, "退出调试...")
 			return
 
 		default:
-			fmt.Println("未知命令", cmd)
+			fmt.Fprintln(p.Stdout, "未知命令", cmd)
+		}
+	}
+}
+
+// 解析调试命令和最多三个数字参数(radix进制), n为成功解析的项数(包含命令)
+// 参数是syms中的标号时取标号的地址(标号优先于数字)
+func scanCommand(line string, radix int, syms SymbolTable) (cmd string, x1, x2, x3, n int) {
+	var fields = strings.Fields(line)
+	if len(fields) == 0 {
+		return
+	}
+	cmd, n = fields[0], 1
+
+	var xs = []*int{&x1, &x2, &x3}
+	for i, s := range fields[1:] {
+		if i >= len(xs) {
+			break
+		}
+		if adr, ok := syms[s]; ok {
+			*xs[i] = int(adr)
+			n++
+			continue
+		}
+		v, err := strconv.ParseInt(s, radix, 32)
+		if err != nil {
+			break
 		}
+		*xs[i] = int(v)
+		n++
 	}
+	return
+}
+
+func onOff(on bool) string {
+	if on {
+		return "打开"
+	}
+	return "关闭"
 }
 
 func (p *Comet) DebugHelp() string {
 	return `命令列表:
   h)elp           显示本命令列表
-  g)o             运行程序直到停止
+  g)o    <n>      运行程序直到停止 （第 n 次遇到断点时暂停, 默认为 1 ）
   s)tep  <n>      执行 n 条指令 （默认为 1 ）
+  stepflag <n>    单步执行直到FR改变 （最多 n 条指令, 默认不限制）
+  b)ack  <n>      回退 n 条指令 （默认为 1, 读取的输入重新排队）
   j)ump  <b>      跳转到 b 地址 （默认为当前地址）
+  break  <b>      在 b 地址设置断点, go 运行到断点时暂停
+  delete <b>      删除 b 地址的断点 （默认删除全部断点）
+  watch  <b>      监视 b 地址的内存, 被修改时暂停 （无参数显示全部监视点）
+  unwatch <b>     删除 b 地址的监视点
   r)egs           显示寄存器内容
+  setreg <r> <v>  修改寄存器 r （GR0 ~ GR4 或 SP）为 v 值
   i)Mem  <b <n>>  显示从 b 开始 n 个内存数据
   d)Mem  <b <n>>  显示从 b 开始 n 个内存指令
   a(lter <b <v>>  修改 b 位置的内存数据为 v 值
-  t)race          开关指令显示功能
+  tos    <n>      显示栈顶的 n 个数据 （默认为 1 ）
+  depth           显示调用深度 （CALL/RET 的嵌套层数）
+  cmpmem <b b2 n> 比较 b 和 b2 开始的 n 个内存数据 （区域可以重叠）
+  in     "text"   输入数据排队, 供后续的输入指令读取
+  dissub <b>      显示从 b 开始到 RET 为止的子程序指令
+  note   <b> "s"  给 b 地址添加注释 s （没有 s 时删除注释）
+  track  <GRn>    显示读写 GRn 的指令 （off 关闭）
+  frames <d <n>>  每步执行之后保存寄存器状态到 d 目录 （最多 n 帧, off 关闭）
+  savelst <file>  程序列表保存到文件
+  teach           汇编教学模式, 输入的汇编指令立即执行
+  t)race  <src>   开关指令显示功能 （src 开关显示对应的源代码）
+  tracedump       显示跟踪缓存中最近执行的指令
   p)rint          开关指令计数功能
+  radix  hex|dec  数字参数按十六进制（默认）或十进制解析
+  display <m>     regs 和 dMem 按 m 显示数据 （hex（默认）, dec 或 bin）
+  info   <break>  显示调试器的设置 （break 显示全部断点）
+  assert <expr>   增加断言, 比如 GR0 == 0, 运行时违反则停止
+                  （无参数显示全部断言, clear 删除全部断言）
+  resetcount      累计的指令计数和时钟周期清零
+  rreset <b>      重置寄存器, 保留内存, 从 b 地址开始 （默认为入口地址）
   c)lear          重置模拟器内容
   q)uit           终止模拟器
 `
 }
 
+// 格式化虚拟机的状态(不含内存数据)
+func (p *Comet) String() string {
+	var buf bytes.Buffer
+
+	var state = "运行中"
+	if p.Shutdown {
+		state = "已停机"
+	}
+
+	fmt.Fprintf(&buf, "PC = %04x\tFR = %04x\tSP = %04x\t%s", p.PC, uint16(p.FR), p.GR[4], state)
+	for i, v := range p.GR {
+		fmt.Fprintf(&buf, "\nGR[%d] = %04x (%d)", i, v, int16(v))
+	}
+
+	return buf.String()
+}
+
 // 格式化pc开始的n个指令
 func (p *Comet) FormatInstruction(pc uint16, n int) string {
 	var buf bytes.Buffer
 
 	for i := 0; i < n; i++ {
+		if p.IsData(pc) {
+			fmt.Fprintf(&buf, "mem[%04x]: DC %d%s\n", pc, int16(p.Mem[pc]), p.noteSuffix(pc))
+			pc++
+			continue
+		}
 		ins, ok := p.ParseInstruction(pc)
 		if !ok {
 			fmt.Fprintf(&buf, "mem[%04x]: 未知\n", pc)
 			break
 		}
 
-		fmt.Fprintf(&buf, "mem[%04x]: %v\n", pc, ins)
+		fmt.Fprintf(&buf, "mem[%04x]: %v%s\n", pc, ins, p.noteSuffix(pc))
+		pc += ins.Op.Size()
+	}
+
+	return buf.String()
+}
+
+// 格式化pc开始的子程序, 到RET指令为止(最多SUBROUTINE_MAX条指令)
+//
+// 如果前面的跳转指令的目标在RET之后, 说明RET只是其中一个分支, 继续显示.
+func (p *Comet) FormatSubroutine(pc uint16) string {
+	var buf bytes.Buffer
+	var jmpMax = pc
+
+	for i := 0; i < SUBROUTINE_MAX; i++ {
+		ins, ok := p.ParseInstruction(pc)
+		if !ok {
+			fmt.Fprintf(&buf, "mem[%04x]: 未知\n", pc)
+			break
+		}
+
+		fmt.Fprintf(&buf, "mem[%04x]: %v%s\n", pc, ins, p.noteSuffix(pc))
+
+		switch ins.Op {
+		case JMP, JPZ, JMI, JNZ, JZE:
+			if ins.XR == 0 && ins.ADR > jmpMax {
+				jmpMax = ins.ADR
+			}
+		case RET:
+			if jmpMax <= pc {
+				return buf.String()
+			}
+		}
 		pc += ins.Op.Size()
 	}
 
@@ -439,20 +1522,46 @@ func (p *Comet) io() {
 	case typ == IO_HEX:
 		format = "%x"
 	default:
-		p.Mem[IO_FLAG] |= IO_ERROR
-		p.Mem[IO_FLAG] &= ^uint16(IO_MAX)
+		p.setIOFlag((p.Mem[IO_FLAG] | IO_ERROR) &^ IO_MAX)
 		return
 	}
 
 	for i := 0; i < int(cnt); i++ {
 		if fio == IO_IN {
-			fmt.Fscanf(p.Stdin, format, &p.Mem[adr])
+			var v uint16
+			if typ == IO_CHR {
+				var c rune
+				fmt.Fscanf(p.stdin(), format, &c)
+				v = p.charMap().Word(c)
+			} else {
+				fmt.Fscanf(p.stdin(), format, &v)
+			}
+			if !p.writeMem(adr, v) {
+				return
+			}
+			adr++
+		} else if typ == IO_CHR {
+			fmt.Fprintf(p.stdout(), format, p.charMap().Rune(p.Mem[adr]))
 			adr++
 		} else {
-			fmt.Fprintf(p.Stdout, format, p.Mem[adr])
+			fmt.Fprintf(p.stdout(), format, p.Mem[adr])
 			adr++
 		}
 	}
 
-	p.Mem[IO_FLAG] &= ^uint16(IO_MAX)
+	p.setIOFlag(p.Mem[IO_FLAG] &^ IO_MAX)
+
+	if fio != IO_IN {
+		p.flush()
+	}
+}
+
+// 刷新输出(需要打开AutoFlush)
+func (p *Comet) flush() {
+	if !p.AutoFlush {
+		return
+	}
+	if w, ok := p.Stdout.(interface{ Flush() error }); ok {
+		w.Flush()
+	}
 }
@@ -0,0 +1,781 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugIn(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     SYSCALL 1
+     ST   GR0,X
+     HALT
+X    DS   1
+     END`)
+	out := runDebug(p, "in \"42\\n\"\ngo\nq\n")
+	if !strings.Contains(out, `输入数据排队 "42\n"`) {
+		t.Fatalf("没有排队的提示:\n%s", out)
+	}
+	if got := int16(p.Mem[4]); got != 42 {
+		t.Fatalf("mem[4] = %d, 期望 42\n%s", got, out)
+	}
+}
+
+func TestCheckBoundary(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LD   GR1,X
+     JMP  1
+X    DC   7
+     END`)
+	p.CheckBoundary = true
+	wantFault(t, p.Run(), FaultBadJump)
+	if p.PC != 1 {
+		t.Fatalf("PC = %x, 期望 1", p.PC)
+	}
+}
+
+func TestString(t *testing.T) {
+	p := NewComet([]uint16{0}, 0, WithRegisters([5]int16{1, -2, 3, 0x123, -5}))
+	p.PC = 0x1a
+
+	s := p.String()
+	for _, want := range []string{
+		"PC = 001a",
+		"GR[0] = 0001 (1)",
+		"GR[1] = fffe (-2)",
+		"GR[2] = 0003 (3)",
+		"GR[3] = 0123 (291)",
+		"GR[4] = fffb (-5)",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("缺少 %q:\n%s", want, s)
+		}
+	}
+}
+
+func TestWithRegisters(t *testing.T) {
+	prog, entry := assembleTest(t, `MAIN START
+     CALL P
+     ADD  GR3,V
+     HALT
+S    LEA  GR3,1,GR2
+     RET
+P    DC   S
+V    DC   100
+     END`)
+
+	// 只设置参数寄存器, SP保持SP_START, CALL/RET正常执行
+	p := NewComet(prog, entry, WithRegisters([5]int16{0, 0, 6, 0, 0}))
+	if p.GR[2] != 6 || p.SP() != SP_START {
+		t.Fatalf("GR2 = %d, SP = %04x, 期望 6, %04x", p.GR[2], p.SP(), SP_START)
+	}
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	// GR3 = GR2+1
+	if p.GR[3] != 107 || p.SP() != SP_START || p.Mem[SP_START-1] != 2 {
+		t.Fatalf("GR3 = %d, SP = %04x, mem[%04x] = %d, 期望 107, %04x, 2", p.GR[3], p.SP(), SP_START-1, p.Mem[SP_START-1], SP_START)
+	}
+
+	// GR4不为0时和WithSP相同(包括栈顶)
+	var sp uint16 = SP_START - 0x100
+	for _, p := range []*Comet{
+		NewComet(prog, entry, WithRegisters([5]int16{0, 0, 6, 0, int16(sp)})),
+		NewComet(prog, entry, WithSP(int16(sp)), WithRegisters([5]int16{2: 6})),
+	} {
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if p.GR[3] != 107 || p.SP() != sp || p.Mem[sp-1] != 2 {
+			t.Fatalf("GR3 = %d, SP = %04x, mem[%04x] = %d, 期望 107, %04x, 2", p.GR[3], p.SP(), sp-1, p.Mem[sp-1], sp)
+		}
+	}
+}
+
+func TestExecAt(t *testing.T) {
+	p := NewComet(nil, 0, WithRegisters([5]int16{0, 5, 0, 0, 0}))
+	code, err := AssembleInstruction("ADD GR1,#300")
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(p.Mem[0x200:], code)
+	p.Mem[0x300] = 7
+
+	if err := p.ExecAt(0x200); err != nil {
+		t.Fatal(err)
+	}
+	if p.GR[1] != 12 {
+		t.Fatalf("GR1 = %d, 期望 12", p.GR[1])
+	}
+	if p.PC != 0x202 {
+		t.Fatalf("PC = %x, 期望 202", p.PC)
+	}
+}
+
+func TestZeroPageProtect(t *testing.T) {
+	const src = `MAIN START
+     ST   GR1,1
+     HALT
+     END`
+
+	p, _ := newTestComet(t, src)
+	p.ZeroPageProtect = true
+	wantFault(t, p.Run(), FaultZeroPage)
+
+	// 默认关闭
+	p, _ = newTestComet(t, src)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewSegmented(t *testing.T) {
+	var code []uint16
+	for _, s := range []string{"LD GR1,#100", "ADD GR1,#200", "HALT"} {
+		ins, err := AssembleInstruction(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code = append(code, ins...)
+	}
+
+	p, err := NewSegmented([]Segment{
+		{Addr: 0x200, Data: []uint16{4}},
+		{Addr: 0, Data: code},
+		{Addr: 0x100, Data: []uint16{3}},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.GR[1] != 7 {
+		t.Fatalf("GR1 = %d, 期望 7", p.GR[1])
+	}
+
+	_, err = NewSegmented([]Segment{
+		{Addr: 0, Data: code},
+		{Addr: 4, Data: []uint16{1}},
+	}, 0)
+	if err == nil {
+		t.Fatal("重叠的内存段没有报错")
+	}
+}
+
+func TestDebugTos(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     PUSH V
+     HALT
+V    DC   #1234
+     END`)
+	out := runDebug(p, "tos\ns\ntos 3\nq\n")
+
+	if !strings.Contains(out, "栈为空") {
+		t.Errorf("空栈没有提示:\n%s", out)
+	}
+	if want := fmt.Sprintf("mem[%04x] = 1234\n", SP_START-1); !strings.Contains(out, want) {
+		t.Errorf("缺少 %q:\n%s", want, out)
+	}
+	if strings.Contains(out, fmt.Sprintf("mem[%04x]", SP_START)) {
+		t.Errorf("显示了栈底之外的数据:\n%s", out)
+	}
+}
+
+func TestDebugResetCount(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,1
+     LEA  GR1,2
+     LEA  GR1,3
+     HALT
+     END`)
+	out := runDebug(p, "p\ns 2\nresetcount\ns\nq\n")
+
+	for _, want := range []string{
+		"执行指令数目 = 2 (累计 2,",
+		"指令计数清零",
+		"执行指令数目 = 1 (累计 1,",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+	if p.InstrCount != 1 {
+		t.Fatalf("InstrCount = %d, 期望 1", p.InstrCount)
+	}
+}
+
+func TestByteLoadStore(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LD   GR1,V
+     STB  GR1,#201
+     LDB  GR2,#201
+     LDBS GR3,#201
+     LDB  GR0,#200
+     HALT
+V    DC   #12F0
+     END`)
+	p.Mem[0x100] = 0xAB00
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Mem[0x100] != 0xABF0 {
+		t.Fatalf("mem[100] = %04x, 期望 abf0", p.Mem[0x100])
+	}
+	if p.GR[2] != 0x00F0 || p.GR[3] != 0xFFF0 || p.GR[0] != 0x00AB {
+		t.Fatalf("GR0 = %04x, GR2 = %04x, GR3 = %04x, 期望 00ab, 00f0, fff0", p.GR[0], p.GR[2], p.GR[3])
+	}
+}
+
+func TestStackUninitialized(t *testing.T) {
+	prog, entry := assembleTest(t, `MAIN START
+     CALL F
+     HALT
+F    RET
+     END`)
+	p := NewComet(prog, entry, WithSP(0))
+
+	err := p.Run()
+	wantFault(t, err, FaultStackUninitialized)
+	if !errors.Is(err, ErrStackUninitialized) {
+		t.Fatalf("err = %v, 期望 %v", err, ErrStackUninitialized)
+	}
+}
+
+func TestPostStep(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+LOOP ADD  GR1,ONE
+     JMP  LOOP
+ONE  DC   1
+     END`)
+
+	var errTooBig = errors.New("GR1 超过 5")
+	var steps int
+	p.PostStep = func(p *Comet, ins Instruction, fault error) error {
+		steps++
+		if p.GR[1] > 5 {
+			return errTooBig
+		}
+		return nil
+	}
+
+	err := p.Run()
+	wantFault(t, err, FaultPostStep)
+	if !errors.Is(err, errTooBig) {
+		t.Fatalf("err = %v, 期望 %v", err, errTooBig)
+	}
+	if p.GR[1] != 6 || steps != 11 || p.Fault().PC != 0 {
+		t.Fatalf("GR1 = %d, 执行 %d 步, 异常地址 %x, 期望 6, 11, 0", p.GR[1], steps, p.Fault().PC)
+	}
+}
+
+func TestDebugRadix(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     HALT
+     END`)
+
+	runDebug(p, "jump 16\nq\n")
+	if p.PC != 0x16 {
+		t.Fatalf("默认十六进制: PC = %x, 期望 16", p.PC)
+	}
+
+	out := runDebug(p, "radix dec\njump 16\nq\n")
+	if p.PC != 16 {
+		t.Fatalf("十进制: PC = %d, 期望 16\n%s", p.PC, out)
+	}
+	if !strings.Contains(out, "命令参数的进制为 10") {
+		t.Fatalf("没有显示进制:\n%s", out)
+	}
+}
+
+func TestEntryOutsideProgram(t *testing.T) {
+	prog := []uint16{uint16(HALT) << 8}
+
+	// 默认只输出警告(写到日志, 不混在程序的输出中)
+	var logBuf, out bytes.Buffer
+	log.SetOutput(&logBuf)
+	defer log.SetOutput(os.Stderr)
+
+	p := NewComet(prog, 4)
+	p.Stdout = &out
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logBuf.String(), "警告: 入口地址 4 超出程序范围(程序大小 1)") {
+		t.Fatalf("没有警告: %q", logBuf.String())
+	}
+	if out.Len() != 0 {
+		t.Fatalf("警告输出到了Stdout: %q", out.String())
+	}
+
+	p = NewComet(prog, 4)
+	p.StrictEntry = true
+	wantFault(t, p.Run(), FaultBadEntry)
+}
+
+func TestDebugEOF(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,1
+     HALT
+     END`)
+
+	var done = make(chan string)
+	go func() { done <- runDebug(p, "s\nr") }()
+
+	select {
+	case out := <-done:
+		if !strings.HasSuffix(out, "退出调试...\n") {
+			t.Fatalf("没有正常退出:\n%s", out)
+		}
+		if p.GR[1] != 1 {
+			t.Fatalf("GR1 = %d, 期望 1", p.GR[1])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("输入结束之后调试器没有退出")
+	}
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	const src = `MAIN START
+     LD   GR1,MAX
+     ADD  GR1,ONE
+     HALT
+MAX  DC   #7FFF
+ONE  DC   1
+     END`
+
+	for _, tt := range []struct {
+		policy   OverflowPolicy
+		gr1      uint16
+		overflow bool
+		fault    bool
+	}{
+		{OverflowWrap, 0x8000, false, false},
+		{OverflowSetFlag, 0x8000, true, false},
+		{OverflowFault, 0x7FFF, false, true},
+	} {
+		p, _ := newTestComet(t, src)
+		p.OverflowPolicy = tt.policy
+		err := p.Run()
+		if tt.fault {
+			wantFault(t, err, FaultOverflow)
+			if p.PC != 2 {
+				t.Errorf("策略 %d: PC = %x, 期望停留在ADD", tt.policy, p.PC)
+			}
+		} else if err != nil {
+			t.Fatalf("策略 %d: %v", tt.policy, err)
+		}
+		if p.GR[1] != tt.gr1 || p.Overflow != tt.overflow {
+			t.Errorf("策略 %d: GR1 = %04x, Overflow = %v, 期望 %04x, %v", tt.policy, p.GR[1], p.Overflow, tt.gr1, tt.overflow)
+		}
+	}
+
+	// 默认为OverflowSetFlag
+	p, _ := newTestComet(t, src)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.OverflowPolicy != OverflowSetFlag || !p.Overflow {
+		t.Fatalf("默认策略 %d, Overflow = %v, 期望 %d, true", p.OverflowPolicy, p.Overflow, OverflowSetFlag)
+	}
+}
+
+func TestDebugDissub(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     HALT
+SUB  LD   GR0,X
+     JZE  L
+     RET
+L    LEA  GR0,1
+     RET
+     LEA  GR1,2
+X    DC   0
+     END`)
+	out := runDebug(p, "dissub 1\nq\n")
+
+	// 跳转目标之前的RET不是子程序的结尾
+	for _, want := range []string{"mem[0001]: LD", "mem[0005]: RET", "mem[0008]: RET"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "mem[0009]") {
+		t.Errorf("没有在RET停止:\n%s", out)
+	}
+}
+
+func TestDebugAssert(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR0,0
+     LEA  GR1,1
+     LEA  GR0,5
+     LEA  GR2,2
+     HALT
+     END`)
+	out := runDebug(p, "assert GR0 == 0\ninfo\ng\nq\n")
+
+	for _, want := range []string{
+		"增加断言 1: GR0 == 0000",
+		"断言(违反时停止) 1: GR0 == 0000",
+		"断言失败：mem[0004] 执行之后 GR0 == 0000 不成立 （GR0 = 0005）",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("缺少 %q:\n%s", want, out)
+		}
+	}
+	if p.PC != 6 || p.GR[2] != 0 {
+		t.Errorf("断言失败之后没有停止: PC = %04x, GR2 = %04x", p.PC, p.GR[2])
+	}
+}
+
+func TestCLR(t *testing.T) {
+	const src = `MAIN START
+     LEA  GR1,5
+     CLR  GR1
+     HALT
+     END`
+	for _, flagBits := range []bool{false, true} {
+		p, _ := newTestComet(t, src)
+		p.FlagBits = flagBits
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if p.GR[1] != 0 || !p.flagZero() {
+			t.Fatalf("FlagBits = %v: GR1 = %04x, FR = %04x, 期望清零并设置零标志", flagBits, p.GR[1], uint16(p.FR))
+		}
+	}
+
+	if s := DisassembleWord(int16(CLR)<<8|0x10, 0); !strings.HasSuffix(s, "\tCLR GR1") {
+		t.Fatalf("反汇编为 %q, 期望 CLR GR1", s)
+	}
+}
+
+func TestDebugNote(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,1
+     HALT
+     END`)
+	out := runDebug(p, "note 0 \"loop counter\"\nc\ni 0 1\nd 0 1\nnote 0\ni 0 1\nq\n")
+
+	for _, want := range []string{"mem[0000]: LEA GR1, 0001\t; loop counter\n", "mem[0000] = 0310\t; loop counter\n"} {
+		if strings.Count(out, want) != 1 {
+			t.Errorf("没有显示注释 %q (clear之后也要保留):\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, "删除 mem[0000] 的注释") || p.Note(0) != "" {
+		t.Errorf("没有删除注释:\n%s", out)
+	}
+}
+
+func TestDebugTrack(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,1
+     LEA  GR2,2
+     ADD  GR1,V
+     ST   GR1,V
+     LD   GR2,V
+     LD   GR3,V,GR1
+     HALT
+V    DC   3
+     END`)
+	out := runDebug(p, "track GR1\ns 6\nq\n")
+
+	var got []string
+	for _, line := range strings.Split(out, "\n") {
+		if i := strings.Index(line, "mem["); i >= 0 && strings.Contains(line, "GR1 =") {
+			got = append(got, strings.Join(strings.Fields(line[i:]), " "))
+		}
+	}
+	var want = []string{
+		"mem[0000]: LEA GR1, 0001 写入 GR1 = 0000 -> 0001",
+		"mem[0004]: ADD GR1, 000d 读写 GR1 = 0001 -> 0004",
+		"mem[0006]: ST GR1, 000d 读取 GR1 = 0004 -> 0004",
+		"mem[000a]: LD GR3, 000d, GR1 读取 GR1 = 0004 -> 0004",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("跟踪GR1:\n%s\n期望:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestBreakAtStep(t *testing.T) {
+	const src = `MAIN START
+     LEA  GR1,0
+L    LEA  GR1,1,GR1
+     CPA  GR1,TEN
+     JNZ  L
+     HALT
+TEN  DC   10
+     END`
+
+	p, _ := newTestComet(t, src)
+	p.BreakAtStep(5)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Shutdown || p.InstrCount != 5 || p.GR[1] != 2 {
+		t.Fatalf("暂停在 %d 条指令之后, GR1 = %d, 停机 = %v, 期望 5 条, GR1 = 2", p.InstrCount, p.GR[1], p.Shutdown)
+	}
+
+	// 只暂停一次, 再次Run继续运行到停机
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Shutdown || p.InstrCount != 32 || p.GR[1] != 10 {
+		t.Fatalf("继续运行: %d 条指令, GR1 = %d, 停机 = %v", p.InstrCount, p.GR[1], p.Shutdown)
+	}
+
+	// 步数限制先到时返回ErrStepLimitExceeded
+	p, _ = newTestComet(t, src)
+	p.MaxSteps = 3
+	p.BreakAtStep(5)
+	if err := p.Run(); err != ErrStepLimitExceeded || p.InstrCount != 3 {
+		t.Fatalf("err = %v, 执行了 %d 条指令, 期望 %v", err, p.InstrCount, ErrStepLimitExceeded)
+	}
+}
+
+func TestResetRegs(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LD   GR0,C
+     ADD  GR0,ONE
+     ST   GR0,C
+     LEA  GR1,7
+     HALT
+ONE  DC   1
+C    DC   0
+     END`)
+	for i := 1; i <= 2; i++ {
+		if i > 1 {
+			p.ResetRegs(0)
+			if p.Shutdown || p.PC != 0 || p.GR != [5]uint16{4: SP_START} || p.FR != 0 {
+				t.Fatalf("ResetRegs之后: %v", p)
+			}
+		}
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if p.Mem[10] != uint16(i) {
+			t.Fatalf("第 %d 次运行之后 C = %d, 期望 %d", i, p.Mem[10], i)
+		}
+	}
+
+	out := runDebug(p, "rreset 0\ng\nq\n")
+	if !strings.Contains(out, "寄存器重置, 内存保持不变 (PC = 0000)") || p.Mem[10] != 3 {
+		t.Fatalf("rreset之后 C = %d:\n%s", p.Mem[10], out)
+	}
+}
+
+func TestCMOVZ(t *testing.T) {
+	for _, tt := range []struct {
+		cmp  int16
+		want uint16
+	}{
+		{3, 9}, // 相等, 零标志有效
+		{4, 1}, // 不相等, 不移动
+	} {
+		for _, flagBits := range []bool{false, true} {
+			p, _ := newTestComet(t, fmt.Sprintf(`MAIN START
+     LEA  GR1,3
+     LEA  GR2,1
+     CPA  GR1,X
+     CMOVZ GR2,V
+     HALT
+X    DC   %d
+V    DC   9
+     END`, tt.cmp))
+			p.FlagBits = flagBits
+			if err := p.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if p.GR[2] != tt.want {
+				t.Fatalf("CPA 3, %d (FlagBits = %v): GR2 = %d, 期望 %d", tt.cmp, flagBits, p.GR[2], tt.want)
+			}
+		}
+	}
+
+	if s := DisassembleWord(int16(CMOVZ)<<8|0x21, 0x10); !strings.HasSuffix(s, "\tCMOVZ GR2, 0010, GR1") {
+		t.Fatalf("反汇编为 %q", s)
+	}
+}
+
+func TestDebugStepFlag(t *testing.T) {
+	const src = `MAIN START
+     LEA  GR1,3
+     LEA  GR2,4
+     CPA  GR1,X
+     HALT
+X    DC   3
+     END`
+
+	p, _ := newTestComet(t, src)
+	p.FlagBits = true
+	out := runDebug(p, "p\nstepflag\nq\n")
+	if !strings.Contains(out, "mem[0004] 修改了FR: 0000 -> 0001\n") || !strings.Contains(out, "执行指令数目 = 3 ") {
+		t.Fatalf("没有在CPA之后停止:\n%s", out)
+	}
+	if p.PC != 6 || p.Shutdown {
+		t.Fatalf("PC = %04x, 期望 0006", p.PC)
+	}
+
+	// 之后没有修改FR的指令, 运行到停机
+	if out := runDebug(p, "stepflag\nq\n"); !p.Shutdown || strings.Contains(out, "修改了FR") {
+		t.Fatalf("FR不变时没有运行到停机:\n%s", out)
+	}
+
+	// 最多执行 n 条指令
+	p, _ = newTestComet(t, src)
+	p.FlagBits = true
+	runDebug(p, "stepflag 2\nq\n")
+	if p.PC != 4 {
+		t.Fatalf("stepflag 2: PC = %04x, 期望 0004", p.PC)
+	}
+}
+
+func TestDebugRedirect(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR0,42
+     SYSCALL 2
+     HALT
+     END`)
+	var in = bytes.NewBufferString("h\ng\nr\nq\n")
+	var out bytes.Buffer
+	p.Stdin = bufio.NewReader(in)
+	p.Stdout = &out
+	p.DebugRun()
+
+	for _, want := range []string{"调试 （帮助输入 help）", p.DebugHelp(), "42\n", "显示寄存器数据\n", "退出调试..."} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("缺少 %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestInstrCount(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,1
+     LEA  GR2,2
+     DIV  GR1,Z
+     HALT
+Z    DC   0
+     END`)
+	wantFault(t, p.Run(), FaultDivideByZero)
+
+	// 异常停机的指令不计数
+	if p.InstrCount != 2 {
+		t.Fatalf("InstrCount = %d, 期望 2", p.InstrCount)
+	}
+	p.Reset()
+	if p.InstrCount != 0 || p.Cycles != 0 {
+		t.Fatalf("Reset之后 InstrCount = %d, Cycles = %d", p.InstrCount, p.Cycles)
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,1
+L    JMP  L
+     END`)
+	p.MaxSteps = 100
+	if err := p.Run(); err != ErrStepLimitExceeded {
+		t.Fatalf("err = %v, 期望 %v", err, ErrStepLimitExceeded)
+	}
+	if p.Shutdown || p.Fault() != nil || p.PC != 2 || p.GR[1] != 1 || p.InstrCount != 100 {
+		t.Fatalf("超过限制之后 PC = %04x, GR1 = %d, 执行了 %d 条指令, 停机 = %v", p.PC, p.GR[1], p.InstrCount, p.Shutdown)
+	}
+
+	// 每次Run重新计算
+	if err := p.Run(); err != ErrStepLimitExceeded || p.InstrCount != 200 {
+		t.Fatalf("err = %v, 执行了 %d 条指令", err, p.InstrCount)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+L    JMP  L
+     END`)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if err := p.RunContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, 期望 %v", err, context.DeadlineExceeded)
+	}
+	if p.Shutdown || p.Fault() != nil || p.PC != 0 || p.InstrCount == 0 {
+		t.Fatalf("取消之后 PC = %04x, 执行了 %d 条指令, 停机 = %v", p.PC, p.InstrCount, p.Shutdown)
+	}
+
+	// 可以继续运行
+	var n = p.InstrCount
+	p.MaxSteps = 10
+	if err := p.RunContext(context.Background()); err != ErrStepLimitExceeded || p.InstrCount != n+10 {
+		t.Fatalf("继续运行: err = %v, 执行了 %d 条指令", err, p.InstrCount-n)
+	}
+}
+
+func TestTEST(t *testing.T) {
+	for _, tt := range []struct {
+		mask uint16
+		flag string
+	}{
+		{0x000F, "001"},
+		{0x0010, "000"},
+		{0x8000, "010"},
+	} {
+		p, _ := newTestComet(t, fmt.Sprintf(`MAIN START
+     LD   GR1,V
+     TEST GR1,M
+     HALT
+V    DC   #80F0
+M    DC   #%04X
+     END`, tt.mask))
+		p.FlagBits = true
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+		if p.GR[1] != 0x80F0 || p.flagString() != tt.flag {
+			t.Errorf("TEST 80f0, %04x: GR1 = %04x, FR = %s, 期望 80f0, %s", tt.mask, p.GR[1], p.flagString(), tt.flag)
+		}
+	}
+
+	if s := DisassembleWord(int16(TEST)<<8|0x10, 0x20); !strings.HasSuffix(s, "\tTEST GR1, 0020") {
+		t.Fatalf("反汇编为 %q", s)
+	}
+}
+
+// 随机填充内存并设置随机的PC, 在有限的步数之内只能停机或异常停机, 不能panic
+func FuzzStepRun(f *testing.F) {
+	f.Add(int64(0), uint16(0), false)
+	f.Add(int64(1), uint16(0x8000), true)
+	f.Add(int64(2019), uint16(0xFFFF), false)
+
+	f.Fuzz(func(t *testing.T, seed int64, pc uint16, flagBits bool) {
+		var r = rand.New(rand.NewSource(seed))
+		var mem = make([]uint16, MEM_SIZE)
+		for i := range mem {
+			mem[i] = uint16(r.Intn(0x10000))
+		}
+
+		p := NewComet(mem, int(pc))
+		p.Stdin = bufio.NewReader(strings.NewReader("12\nabc\n"))
+		p.Stdout = new(bytes.Buffer)
+		p.FlagBits = flagBits
+
+		for i := 0; i < 1000 && !p.Shutdown; i++ {
+			if err := p.StepRun(); err != nil {
+				break
+			}
+		}
+	})
+}
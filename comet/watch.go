@@ -0,0 +1,130 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"sort"
+)
+
+// 默认保留的监视点快照数目(WatchSnapshotLimit)
+const WATCH_SNAPSHOT_MAX = 16
+
+// 监视点被修改的记录
+type WatchHit struct {
+	PC   uint16 // 修改内存的指令地址
+	Addr uint16 // 监视的地址
+	Old  uint16 // 修改之前的值
+	New  uint16 // 修改之后的值
+}
+
+// 监视点触发时保存的快照
+type WatchSnapshot struct {
+	WatchHit
+	State *VMState // 修改内存的指令执行之后的状态
+}
+
+// 设置监视点: 指令修改了addr位置的内存之后Run暂停(无效地址被忽略)
+//
+// 每步只比较监视的地址, 不比较整个内存.
+func (p *Comet) SetWatch(addr int) {
+	if addr < 0 || addr >= MEM_SIZE {
+		return
+	}
+	if p.watches == nil {
+		p.watches = make(map[uint16]uint16)
+	}
+	p.watches[uint16(addr)] = p.Mem[addr]
+}
+
+// 设置监视点, 并且每次触发时保存快照(见WatchSnapshots)
+func (p *Comet) SetWatchSnapshot(addr int) {
+	if addr < 0 || addr >= MEM_SIZE {
+		return
+	}
+	p.SetWatch(addr)
+	if p.watchSnap == nil {
+		p.watchSnap = make(map[uint16]bool)
+	}
+	p.watchSnap[uint16(addr)] = true
+}
+
+// 删除监视点, 返回监视点是否存在
+func (p *Comet) ClearWatch(addr int) bool {
+	if addr < 0 || addr >= MEM_SIZE {
+		return false
+	}
+	if _, ok := p.watches[uint16(addr)]; !ok {
+		return false
+	}
+	delete(p.watches, uint16(addr))
+	delete(p.watchSnap, uint16(addr))
+	return true
+}
+
+// 返回全部监视点(按地址排序)
+func (p *Comet) Watches() []uint16 {
+	var list = make([]uint16, 0, len(p.watches))
+	for adr := range p.watches {
+		list = append(list, adr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i] < list[j] })
+	return list
+}
+
+// 返回并清除最近触发的监视点
+func (p *Comet) WatchHits() []WatchHit {
+	var hits = p.watchHits
+	p.watchHits = nil
+	return hits
+}
+
+// 返回保存的监视点快照(按触发的顺序)
+//
+// 最多保留WatchSnapshotLimit个(0表示WATCH_SNAPSHOT_MAX), 超过时丢弃最早的快照.
+func (p *Comet) WatchSnapshots() []WatchSnapshot {
+	return p.watchSnaps
+}
+
+// 清除保存的监视点快照
+func (p *Comet) ClearWatchSnapshots() {
+	p.watchSnaps = nil
+}
+
+// 比较监视的地址, pc为修改内存的指令地址
+func (p *Comet) checkWatches(pc uint16) {
+	var hits []WatchHit
+	for adr, old := range p.watches {
+		if v := p.Mem[adr]; v != old {
+			hits = append(hits, WatchHit{PC: pc, Addr: adr, Old: old, New: v})
+			p.watches[adr] = v
+		}
+	}
+
+	// 同一条指令修改了多个监视点时按地址排序(不依赖map的遍历顺序)
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Addr < hits[j].Addr })
+
+	var state *VMState
+	for _, hit := range hits {
+		p.watchHits = append(p.watchHits, hit)
+		if p.watchSnap[hit.Addr] {
+			if state == nil {
+				state = p.Snapshot()
+			}
+			p.addWatchSnapshot(WatchSnapshot{WatchHit: hit, State: state})
+		}
+	}
+}
+
+func (p *Comet) addWatchSnapshot(s WatchSnapshot) {
+	var limit = p.WatchSnapshotLimit
+	if limit <= 0 {
+		limit = WATCH_SNAPSHOT_MAX
+	}
+	if len(p.watchSnaps) >= limit {
+		var n = copy(p.watchSnaps, p.watchSnaps[len(p.watchSnaps)-limit+1:])
+		p.watchSnaps = p.watchSnaps[:n]
+	}
+	p.watchSnaps = append(p.watchSnaps, s)
+}
@@ -0,0 +1,137 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWatch(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,5
+     ST   GR1,X
+     LEA  GR1,6
+     LEA  GR1,7
+     ST   GR1,X
+     HALT
+X    DC   0
+     END`)
+	p.SetWatch(0x0b)
+
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Shutdown || p.PC != 4 {
+		t.Fatalf("PC = %04x, 期望在 ST 之后暂停", p.PC)
+	}
+
+	// 没有取走的记录不影响下次Run
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Shutdown || p.PC != 10 || p.InstrCount != 5 {
+		t.Fatalf("PC = %04x, 执行了 %d 条指令, 期望在第二个 ST 之后暂停", p.PC, p.InstrCount)
+	}
+	var want = []WatchHit{{PC: 2, Addr: 0x0b, Old: 0, New: 5}, {PC: 8, Addr: 0x0b, Old: 5, New: 7}}
+	if hits := p.WatchHits(); !reflect.DeepEqual(hits, want) {
+		t.Fatalf("WatchHits = %+v, 期望 %+v", hits, want)
+	}
+
+	if err := p.Run(); err != nil || !p.Shutdown {
+		t.Fatalf("err = %v, 没有运行到停机", err)
+	}
+
+	// 调试器的alter也会触发监视点
+	p, _ = newTestComet(t, "MAIN START\n     HALT\n     END")
+	out := runDebug(p, "watch 10\na 10 3\nunwatch 10\nunwatch 10\nq\n")
+	for _, s := range []string{"设置监视点 mem[0010]", "监视点 mem[0010] 被", "0000 -> 0003", "错误: 没有该监视点"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("缺少 %q:\n%s", s, out)
+		}
+	}
+}
+
+func TestWatchSnapshots(t *testing.T) {
+	// 循环5次, 每次把GR1写入X
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR1,5
+L    ST   GR1,X
+     LEA  GR1,-1,GR1
+     JNZ  L
+     HALT
+X    DC   0
+     END`)
+	p.SetWatchSnapshot(9)
+	p.WatchSnapshotLimit = 3
+
+	for i := 0; !p.Shutdown; i++ {
+		if i > 10 {
+			t.Fatal("没有运行到停机")
+		}
+		if err := p.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 只保留最后3次
+	snaps := p.WatchSnapshots()
+	if len(snaps) != 3 {
+		t.Fatalf("保存了 %d 个快照, 期望 3", len(snaps))
+	}
+	for i, s := range snaps {
+		var v = uint16(3 - i)
+		if s.PC != 2 || s.Addr != 9 || s.Old != v+1 || s.New != v || s.State.Mem[9] != v || s.State.GR[1] != v || s.State.PC != 4 {
+			t.Errorf("第 %d 个快照: %+v, mem[0009] = %d, GR1 = %d", i, s.WatchHit, s.State.Mem[9], s.State.GR[1])
+		}
+	}
+	if snaps[0].State.InstrCount >= snaps[1].State.InstrCount || snaps[1].State.InstrCount >= snaps[2].State.InstrCount {
+		t.Errorf("快照的指令数目没有增加")
+	}
+
+	// 普通的监视点不保存快照
+	p.ClearWatchSnapshots()
+	p.WatchHits()
+	p.SetWatch(9)
+	p.ClearWatch(9)
+	p.SetWatch(9)
+	p.ResetRegs(0)
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.WatchHits()) != 1 || len(p.WatchSnapshots()) != 0 {
+		t.Fatalf("普通的监视点保存了 %d 个快照", len(p.WatchSnapshots()))
+	}
+}
+
+func TestWatchHitsOrder(t *testing.T) {
+	// 一条IN指令修改多个监视点
+	p, _ := newTestComet(t, `MAIN START
+     LEA  GR0,BUF
+     LEA  GR1,6
+     SYSCALL 3
+     HALT
+BUF  DS   6
+     END`)
+	p.Stdin = bufio.NewReader(strings.NewReader("abcdef"))
+	for _, adr := range []int{11, 8, 10, 6, 9, 7} {
+		p.SetWatch(adr)
+	}
+
+	if err := p.Run(); err != nil {
+		t.Fatal(err)
+	}
+	var hits = p.WatchHits()
+	if len(hits) != 6 {
+		t.Fatalf("WatchHits = %+v, 期望 6 个", hits)
+	}
+	for i, hit := range hits {
+		if want := (WatchHit{PC: 4, Addr: uint16(6 + i), New: uint16('a' + i)}); hit != want {
+			t.Fatalf("WatchHits[%d] = %+v, 期望 %+v", i, hit, want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"sort"
+)
+
+// 写入地址的记录
+type writeLog struct {
+	adrs map[uint16]bool
+}
+
+// 开始记录写入的内存地址, 返回结束记录的函数
+//
+// 结束函数返回开始记录以来写入的地址(去重, 从小到大排序),
+// 重复调用结束函数返回同样的结果. 可以同时有多个记录.
+func (p *Comet) RecordWrites() func() []uint16 {
+	var log = &writeLog{adrs: make(map[uint16]bool)}
+	p.writeLogs = append(p.writeLogs, log)
+
+	var result []uint16
+	return func() []uint16 {
+		if result != nil {
+			return result
+		}
+
+		for i, x := range p.writeLogs {
+			if x == log {
+				p.writeLogs = append(p.writeLogs[:i], p.writeLogs[i+1:]...)
+				break
+			}
+		}
+
+		result = make([]uint16, 0, len(log.adrs))
+		for adr := range log.adrs {
+			result = append(result, adr)
+		}
+		sort.Slice(result, func(i, j int) bool {
+			return result[i] < result[j]
+		})
+		return result
+	}
+}
+
+// 记录写入的地址
+func (p *Comet) logWrite(adr uint16) {
+	for _, x := range p.writeLogs {
+		x.adrs[adr] = true
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright 2019 <chaishushan{AT}gmail.com>. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package comet
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordWrites(t *testing.T) {
+	p, _ := newTestComet(t, `MAIN START
+     HALT
+SUB  ST   GR0,C
+     ST   GR0,A
+     ST   GR0,B
+     ST   GR0,A
+     RET
+A    DS   1
+B    DS   1
+C    DS   1
+     END`)
+
+	stop := p.RecordWrites()
+	if _, err := p.CallSubroutine(1, []int16{5}, 100); err != nil {
+		t.Fatal(err)
+	}
+	got := stop()
+
+	// 返回地址压栈也是写入
+	var want = []uint16{0x000a, 0x000b, 0x000c, SP_START - 1}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("写入的地址 %04x, 期望 %04x", got, want)
+	}
+
+	if _, err := p.CallSubroutine(1, []int16{6}, 100); err != nil {
+		t.Fatal(err)
+	}
+	if got := stop(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("结束之后的写入也被记录: %04x", got)
+	}
+}
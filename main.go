@@ -8,8 +8,10 @@ package main
 import (
 	"encoding/binary"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/chai2010/tinylang/comet"
 )
@@ -17,6 +19,11 @@ import (
 var (
 	flagFile  = flag.String("f", "sum.comet", "comet app file")
 	flagDebug = flag.Bool("d", false, "debug mode")
+	flagTrace = flag.Int("trace", 0, "keep the last N instructions for tracedump")
+	flagCore  = flag.String("core", "", "write a core dump to this dir on fault")
+	flagLoad  = flag.String("load-core", "", "load a core dump into the debugger")
+	flagMap   = flag.String("map", "", "source line map file (casl -map)")
+	flagSym   = flag.String("sym", "", "symbol table file (casl -sym)")
 )
 
 func init() {
@@ -26,14 +33,59 @@ func init() {
 func main() {
 	flag.Parse()
 
+	if *flagLoad != "" {
+		debugCore(*flagLoad)
+		return
+	}
+
 	bin, pc := loadBin(*flagFile)
 	vm := comet.NewComet(bin, pc)
+	vm.TraceBuffer = *flagTrace
+	vm.CoreDir = *flagCore
+
+	if *flagMap != "" {
+		m, err := comet.LoadSourceMap(*flagMap)
+		if err != nil {
+			log.Fatal(err)
+		}
+		vm.Source = m
+	}
+	if *flagSym != "" {
+		syms, err := comet.LoadSymbols(*flagSym)
+		if err != nil {
+			log.Fatal(err)
+		}
+		vm.Symbols = syms
+	}
 
 	if *flagDebug {
 		vm.DebugRun()
-	} else {
-		vm.Run()
+	} else if err := vm.Run(); err != nil {
+		fmt.Println(err)
 	}
+
+	os.Exit(vm.ExitCode)
+}
+
+// 载入core文件并进入调试模式
+func debugCore(path string) {
+	core, err := comet.LoadCore(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	vm := comet.NewComet(nil, 0)
+	vm.CPU = core.CPU
+
+	fmt.Println("异常停机:", core.Fault)
+	if core.Trace != "" {
+		fmt.Println("最近执行的指令:")
+		fmt.Print(core.Trace)
+	}
+	fmt.Println(vm)
+	fmt.Println()
+
+	vm.DebugRun()
 }
 
 func loadBin(path string) (bin []uint16, pc int) {
@@ -43,6 +95,14 @@ func loadBin(path string) (bin []uint16, pc int) {
 	}
 	defer f.Close()
 
+	// 文本格式的程序(从0地址开始执行)
+	if strings.HasSuffix(path, ".txt") {
+		if bin, err = comet.LoadText(f); err != nil {
+			log.Fatal(err)
+		}
+		return bin, 0
+	}
+
 	var hdr struct {
 		PC  uint16
 		Len uint16